@@ -32,6 +32,7 @@ type ABI struct {
 	Constructor Method
 	Methods     map[string]Method
 	Events      map[string]Event
+	Errors      map[string]Error
 }
 
 // JSON returns a parsed ABI interface and error if it failed.
@@ -128,6 +129,7 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 
 	abi.Methods = make(map[string]Method)
 	abi.Events = make(map[string]Event)
+	abi.Errors = make(map[string]Error)
 	for _, field := range fields {
 		switch field.Type {
 		case "constructor":
@@ -160,6 +162,17 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 				Anonymous: field.Anonymous,
 				Inputs:    field.Inputs,
 			}
+		case "error":
+			name := field.Name
+			_, ok := abi.Errors[name]
+			for idx := 0; ok; idx++ {
+				name = fmt.Sprintf("%s%d", field.Name, idx)
+				_, ok = abi.Errors[name]
+			}
+			abi.Errors[name] = Error{
+				Name:   field.Name,
+				Inputs: field.Inputs,
+			}
 		}
 	}
 
@@ -190,3 +203,17 @@ func (abi *ABI) EventByID(topic common.Hash) (*Event, error) {
 	}
 	return nil, fmt.Errorf("no event with id: %#x", topic.Hex())
 }
+
+// ErrorByID looks up a custom error by the 4-byte selector at the start of
+// the given revert data and returns nil if none found.
+func (abi *ABI) ErrorByID(sigdata []byte) (*Error, error) {
+	if len(sigdata) < 4 {
+		return nil, fmt.Errorf("data too short (%d bytes) for abi error lookup", len(sigdata))
+	}
+	for _, e := range abi.Errors {
+		if bytes.Equal(e.Id(), sigdata[:4]) {
+			return &e, nil
+		}
+	}
+	return nil, fmt.Errorf("no error with id: %#x", sigdata[:4])
+}
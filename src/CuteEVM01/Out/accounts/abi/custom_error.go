@@ -0,0 +1,48 @@
+package abi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"CuteEVM01/Out/crypto"
+)
+
+// Error is a custom Solidity error declared in the ABI. A reverting contract
+// returns its 4-byte selector followed by the ABI encoded arguments.
+type Error struct {
+	Name   string
+	Inputs Arguments
+}
+
+// Sig returns the error's string signature according to the ABI spec, e.g.
+// "InsufficientBalance(uint256,uint256)".
+func (e Error) Sig() string {
+	types := make([]string, len(e.Inputs))
+	for i, input := range e.Inputs {
+		types[i] = input.Type.String()
+	}
+	return fmt.Sprintf("%v(%v)", e.Name, strings.Join(types, ","))
+}
+
+func (e Error) String() string {
+	inputs := make([]string, len(e.Inputs))
+	for i, input := range e.Inputs {
+		inputs[i] = fmt.Sprintf("%v %v", input.Type, input.Name)
+	}
+	return fmt.Sprintf("error %v(%v)", e.Name, strings.Join(inputs, ", "))
+}
+
+// Id returns the 4-byte selector identifying the error in revert data.
+func (e Error) Id() []byte {
+	return crypto.Keccak256([]byte(e.Sig()))[:4]
+}
+
+// Unpack decodes the arguments of the given revert data, which must start
+// with the error's selector.
+func (e Error) Unpack(data []byte) ([]interface{}, error) {
+	if len(data) < 4 || !bytes.Equal(data[:4], e.Id()) {
+		return nil, fmt.Errorf("abi: revert data is not an encoded %v", e.Sig())
+	}
+	return e.Inputs.UnpackValues(data[4:])
+}
@@ -0,0 +1,27 @@
+package core
+
+import "errors"
+
+// 交易执行的共识错误: 出现这些错误时交易是无效的，不会改变任何状态
+var (
+	// ErrGasLimitReached 区块剩余的gas不足以支付交易的gas上限
+	ErrGasLimitReached = errors.New("gas limit reached")
+
+	// ErrNonceTooLow 交易的nonce低于发送者账户的nonce
+	ErrNonceTooLow = errors.New("nonce too low")
+
+	// ErrNonceTooHigh 交易的nonce高于发送者账户的nonce
+	ErrNonceTooHigh = errors.New("nonce too high")
+
+	// ErrInsufficientFunds 发送者的余额不足以支付 gas * price
+	ErrInsufficientFunds = errors.New("insufficient funds for gas * price")
+
+	// ErrIntrinsicGas 交易的gas上限低于其固有gas
+	ErrIntrinsicGas = errors.New("intrinsic gas too low")
+
+	// ErrGasUintOverflow 计算gas时发生uint64溢出
+	ErrGasUintOverflow = errors.New("gas uint64 overflow")
+
+	// ErrFeeCapTooLow 伦敦分叉之后，交易的gas价格低于区块的base fee
+	ErrFeeCapTooLow = errors.New("gas price less than block base fee")
+)
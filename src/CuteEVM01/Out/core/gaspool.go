@@ -0,0 +1,36 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+// GasPool 记录一个区块中交易执行期间仍然可用的gas
+type GasPool uint64
+
+// AddGas 使gas可用于执行
+func (gp *GasPool) AddGas(amount uint64) *GasPool {
+	if uint64(*gp) > math.MaxUint64-amount {
+		panic("gas pool pushed above uint64")
+	}
+	*(*uint64)(gp) += amount
+	return gp
+}
+
+// SubGas 如果有足够的gas可用，则从池中扣除给定的数量，否则返回错误
+func (gp *GasPool) SubGas(amount uint64) error {
+	if uint64(*gp) < amount {
+		return ErrGasLimitReached
+	}
+	*(*uint64)(gp) -= amount
+	return nil
+}
+
+// Gas 返回池中剩余的gas
+func (gp *GasPool) Gas() uint64 {
+	return uint64(*gp)
+}
+
+func (gp *GasPool) String() string {
+	return fmt.Sprintf("%d", *gp)
+}
@@ -137,6 +137,41 @@ func WriteHeadBlockHash(db ethdb.KeyValueWriter, hash common.Hash) {
 	}
 }
 
+// ReadHeadStateRoot retrieves the root of the last committed state.
+func ReadHeadStateRoot(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(headStateKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteHeadStateRoot stores the root of the last committed state.
+func WriteHeadStateRoot(db ethdb.KeyValueWriter, root common.Hash) {
+	if err := db.Put(headStateKey, root.Bytes()); err != nil {
+		log.Crit("Failed to store last state root", "err", err)
+	}
+}
+
+// ReadHeadRemoteBlock retrieves the number of the remote block the last
+// committed state forks off, or nil if it does not fork off a remote chain.
+func ReadHeadRemoteBlock(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(headRemoteBlockKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteHeadRemoteBlock stores the number of the remote block the last
+// committed state forks off.
+func WriteHeadRemoteBlock(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(headRemoteBlockKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store last remote block", "err", err)
+	}
+}
+
 // ReadHeadFastBlockHash retrieves the hash of the current fast-sync head block.
 func ReadHeadFastBlockHash(db ethdb.KeyValueReader) common.Hash {
 	data, _ := db.Get(headFastBlockKey)
@@ -41,6 +41,12 @@ var (
 	// fastTrieProgressKey tracks the number of trie entries imported during fast sync.
 	fastTrieProgressKey = []byte("TrieSync")
 
+	// headStateKey tracks the root of the last committed state of a standalone EVM session.
+	headStateKey = []byte("LastState")
+
+	// headRemoteBlockKey tracks the remote block the last committed state of a standalone EVM session forks off.
+	headRemoteBlockKey = []byte("LastRemoteBlock")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
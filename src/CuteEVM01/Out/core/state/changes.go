@@ -0,0 +1,154 @@
+package state
+
+import (
+	"fmt"
+
+	"CuteEVM01/Out/common"
+)
+
+// ChangeField identifies the part of the state modified by a StateChange.
+type ChangeField string
+
+// The concrete types of StateChange.Prev and StateChange.New per field are
+// noted next to each field.
+const (
+	ChangeCreate            ChangeField = "create"            // bool: whether an account was replaced
+	ChangeSuicide           ChangeField = "suicide"           // bool
+	ChangeBalance           ChangeField = "balance"           // *big.Int
+	ChangeNonce             ChangeField = "nonce"             // uint64
+	ChangeCode              ChangeField = "code"              // []byte
+	ChangeStorage           ChangeField = "storage"           // common.Hash
+	ChangeTransientStorage  ChangeField = "transientStorage"  // common.Hash
+	ChangeTouch             ChangeField = "touch"             // nil
+	ChangeRefund            ChangeField = "refund"            // uint64
+	ChangeLog               ChangeField = "log"               // nil, *types.Log
+	ChangePreimage          ChangeField = "preimage"          // nil, []byte
+	ChangeAccessListAddress ChangeField = "accessListAddress" // bool
+	ChangeAccessListSlot    ChangeField = "accessListSlot"    // bool
+)
+
+// StateChange is a single journalled modification of the state.
+type StateChange struct {
+	// Snapshot is the id of the innermost snapshot taken before the change,
+	// or -1 if the change precedes all live snapshots.
+	Snapshot int
+
+	Address common.Address // zero for refund and preimage changes
+	Field   ChangeField
+	Key     common.Hash // slot of storage and access list changes, hash of preimages
+
+	Prev, New interface{}
+}
+
+// Changes returns the modifications of the current transaction, as set by
+// Prepare, in the order they were applied. Reverted modifications are not
+// included. Unless RecordChanges is enabled, the journal backing the log is
+// discarded by Finalise and Commit, so only the modifications since the last
+// of those calls are returned.
+func (s *StateDB) Changes() []StateChange {
+	return s.TxChanges(s.thash)
+}
+
+// TxChanges returns the modifications of the transaction with the given hash:
+// those recorded when its journal was discarded by Finalise or Commit (see
+// RecordChanges), followed by the live journal if it is the current one.
+func (s *StateDB) TxChanges(thash common.Hash) []StateChange {
+	changes := append([]StateChange(nil), s.changeLog[thash]...)
+	if thash == s.thash {
+		changes = append(changes, s.changes(0)...)
+	}
+	return changes
+}
+
+// RecordChanges enables or disables recording of the change log across
+// Finalise, IntermediateRoot and Commit. While enabled, the journal is saved
+// under the hash of the current transaction each time it is discarded, so the
+// full log of every transaction stays available through TxChanges until
+// ResetChanges is called. Modifications made outside transactions, e.g. block
+// rewards, are recorded under the hash set by the last Prepare.
+func (s *StateDB) RecordChanges(enable bool) {
+	s.recordChanges = enable
+}
+
+// ResetChanges discards all recorded change logs. The live journal is kept.
+func (s *StateDB) ResetChanges() {
+	s.changeLog = nil
+}
+
+// flushChanges saves the live journal to the change log if recording is
+// enabled. It is called before the journal is discarded.
+func (s *StateDB) flushChanges() {
+	if !s.recordChanges || len(s.journal.entries) == 0 {
+		return
+	}
+	if s.changeLog == nil {
+		s.changeLog = make(map[common.Hash][]StateChange)
+	}
+	s.changeLog[s.thash] = append(s.changeLog[s.thash], s.changes(0)...)
+}
+
+// copyChangeLog returns a copy of the change log that can be appended to
+// independently of the original.
+func copyChangeLog(log map[common.Hash][]StateChange) map[common.Hash][]StateChange {
+	if log == nil {
+		return nil
+	}
+	cpy := make(map[common.Hash][]StateChange, len(log))
+	for thash, changes := range log {
+		cpy[thash] = changes[:len(changes):len(changes)]
+	}
+	return cpy
+}
+
+// ChangesSince returns the modifications applied after the given snapshot was
+// taken, in the order they were applied.
+func (s *StateDB) ChangesSince(revid int) ([]StateChange, error) {
+	for _, rev := range s.validRevisions {
+		if rev.id == revid {
+			return s.changes(rev.journalIndex), nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot %d is not valid", revid)
+}
+
+// changes converts the journal entries starting at index from.
+func (s *StateDB) changes(from int) []StateChange {
+	var (
+		changes []StateChange
+		rev     = 0
+		snap    = -1
+	)
+	for i, entry := range s.journal.entries {
+		for rev < len(s.validRevisions) && s.validRevisions[rev].journalIndex <= i {
+			snap = s.validRevisions[rev].id
+			rev++
+		}
+		if i < from {
+			continue
+		}
+		for _, change := range entry.changes(s) {
+			change.Snapshot = snap
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// String renders the change in a human readable form.
+func (c StateChange) String() string {
+	switch c.Field {
+	case ChangeRefund:
+		return fmt.Sprintf("[%d] refund: %v -> %v", c.Snapshot, c.Prev, c.New)
+	case ChangePreimage:
+		return fmt.Sprintf("[%d] preimage %x: %x", c.Snapshot, c.Key, c.New)
+	case ChangeTouch, ChangeLog, ChangeAccessListAddress:
+		return fmt.Sprintf("[%d] %x %s", c.Snapshot, c.Address, c.Field)
+	case ChangeAccessListSlot:
+		return fmt.Sprintf("[%d] %x %s %x", c.Snapshot, c.Address, c.Field, c.Key)
+	case ChangeStorage, ChangeTransientStorage:
+		return fmt.Sprintf("[%d] %x %s %x: %x -> %x", c.Snapshot, c.Address, c.Field, c.Key, c.Prev, c.New)
+	case ChangeCode:
+		return fmt.Sprintf("[%d] %x code: %x -> %x", c.Snapshot, c.Address, c.Prev, c.New)
+	}
+	return fmt.Sprintf("[%d] %x %s: %v -> %v", c.Snapshot, c.Address, c.Field, c.Prev, c.New)
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"fmt"
+)
+
+// Checkpoints manages named savepoints of a StateDB. Unlike the revisions
+// returned by Snapshot, savepoints hold a full copy of the state, so they stay
+// valid across top-level calls, Finalise, IntermediateRoot and Commit. The
+// copies share the underlying Database with the managed state, unchanged
+// accounts and storage are loaded from it on demand.
+//
+// Savepoints are nested: reverting to a savepoint discards all savepoints
+// taken after it.
+type Checkpoints struct {
+	state *StateDB
+	names []string            // savepoint names in the order they were taken
+	saved map[string]*StateDB // savepoint name -> copy of the state
+}
+
+// NewCheckpoints creates a savepoint manager for the given state.
+func NewCheckpoints(state *StateDB) *Checkpoints {
+	return &Checkpoints{
+		state: state,
+		saved: make(map[string]*StateDB),
+	}
+}
+
+// Save records the current state as a savepoint with the given name. An
+// existing savepoint with the same name is replaced and moves to the top of
+// the stack, the savepoints taken after it are kept.
+func (c *Checkpoints) Save(name string) {
+	if i := c.index(name); i >= 0 {
+		c.names = append(c.names[:i], c.names[i+1:]...)
+	}
+	c.names = append(c.names, name)
+	c.saved[name] = c.state.savepoint()
+}
+
+// Revert restores the managed state to the given savepoint in place and
+// discards all savepoints taken after it. The savepoint itself is kept, so it
+// can be reverted to again. Snapshot ids of the managed state are invalidated.
+func (c *Checkpoints) Revert(name string) error {
+	saved, ok := c.saved[name]
+	if !ok {
+		return fmt.Errorf("unknown savepoint %q", name)
+	}
+	c.drop(c.index(name) + 1)
+	c.state.restore(saved)
+	return nil
+}
+
+// Fork returns an independent copy of the state at the given savepoint.
+// Modifying the fork does not affect the managed state or the savepoint.
+func (c *Checkpoints) Fork(name string) (*StateDB, error) {
+	saved, ok := c.saved[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown savepoint %q", name)
+	}
+	return saved.savepoint(), nil
+}
+
+// Release discards the given savepoint and all savepoints taken after it,
+// leaving the managed state untouched.
+func (c *Checkpoints) Release(name string) error {
+	if _, ok := c.saved[name]; !ok {
+		return fmt.Errorf("unknown savepoint %q", name)
+	}
+	c.drop(c.index(name))
+	return nil
+}
+
+// Names returns the names of the live savepoints, oldest first.
+func (c *Checkpoints) Names() []string {
+	return append([]string(nil), c.names...)
+}
+
+// index returns the position of a live savepoint in the savepoint stack.
+func (c *Checkpoints) index(name string) int {
+	for i, n := range c.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// drop discards the savepoints from position i onwards.
+func (c *Checkpoints) drop(i int) {
+	for _, name := range c.names[i:] {
+		delete(c.saved, name)
+	}
+	c.names = c.names[:i]
+}
+
+// savepoint returns a copy of the state that also carries over the database
+// error and the transaction context, which Copy leaves out.
+func (s *StateDB) savepoint() *StateDB {
+	cpy := s.Copy()
+	cpy.dbErr = s.dbErr
+	cpy.thash, cpy.bhash, cpy.txIndex = s.thash, s.bhash, s.txIndex
+	return cpy
+}
+
+// restore replaces the contents of the state with a copy of src. The journal
+// and all snapshots are discarded, the revision id counter keeps counting so
+// stale ids are never reused.
+func (s *StateDB) restore(src *StateDB) {
+	cpy := src.savepoint()
+	for _, obj := range cpy.stateObjects {
+		obj.db = s
+	}
+	cpy.nextRevisionId = s.nextRevisionId
+	*s = *cpy
+}
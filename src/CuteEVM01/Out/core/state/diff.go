@@ -0,0 +1,224 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/crypto"
+	"CuteEVM01/Out/rlp"
+	"CuteEVM01/Out/trie"
+)
+
+// AccountDiff describes how a single account differs between two state roots.
+// Accounts missing from one of the states are reported with zero values on
+// that side and Created or Deleted set.
+type AccountDiff struct {
+	Address  common.Address // zero if the preimage of AddrHash is unknown
+	AddrHash common.Hash
+	Created  bool // the account does not exist in the first state
+	Deleted  bool // the account does not exist in the second state
+
+	PrevBalance, Balance   *big.Int
+	PrevNonce, Nonce       uint64
+	PrevCodeHash, CodeHash common.Hash
+
+	Storage []StorageDiff // changed slots, ordered by key hash
+}
+
+// StorageDiff describes a changed storage slot. Slots missing from one of the
+// states are reported with a zero value on that side.
+type StorageDiff struct {
+	Key     common.Hash // zero if the preimage of KeyHash is unknown
+	KeyHash common.Hash
+	Prev    common.Hash
+	Value   common.Hash
+}
+
+// Diff returns the accounts differing between the states at rootA and rootB,
+// ordered by address hash. Hashed keys are resolved back to addresses and
+// slot keys using the preimages recorded in the trie database, as far as they
+// are available.
+func Diff(db Database, rootA, rootB common.Hash) ([]*AccountDiff, error) {
+	trA, err := db.OpenTrie(rootA)
+	if err != nil {
+		return nil, err
+	}
+	trB, err := db.OpenTrie(rootB)
+	if err != nil {
+		return nil, err
+	}
+	prev, post, err := diffLeaves(trA, trB)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []*AccountDiff
+	for _, hash := range sortedKeys(prev, post) {
+		var (
+			diff      = &AccountDiff{AddrHash: hash}
+			a, b      Account
+			encA, okA = prev[hash]
+			encB, okB = post[hash]
+		)
+		if okA {
+			if err := rlp.DecodeBytes(encA, &a); err != nil {
+				return nil, fmt.Errorf("account %x: %v", hash, err)
+			}
+			diff.Address = common.BytesToAddress(trA.GetKey(hash[:]))
+		} else {
+			a = Account{Balance: new(big.Int), Root: emptyRoot, CodeHash: emptyCode[:]}
+			diff.Created = true
+		}
+		if okB {
+			if err := rlp.DecodeBytes(encB, &b); err != nil {
+				return nil, fmt.Errorf("account %x: %v", hash, err)
+			}
+			if preimage := trB.GetKey(hash[:]); preimage != nil {
+				diff.Address = common.BytesToAddress(preimage)
+			}
+		} else {
+			b = Account{Balance: new(big.Int), Root: emptyRoot, CodeHash: emptyCode[:]}
+			diff.Deleted = true
+		}
+		diff.PrevBalance, diff.Balance = a.Balance, b.Balance
+		diff.PrevNonce, diff.Nonce = a.Nonce, b.Nonce
+		diff.PrevCodeHash, diff.CodeHash = common.BytesToHash(a.CodeHash), common.BytesToHash(b.CodeHash)
+
+		if a.Root != b.Root {
+			if diff.Storage, err = diffStorage(db, hash, a.Root, b.Root); err != nil {
+				return nil, fmt.Errorf("account %x: %v", hash, err)
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// diffStorage returns the changed slots between two storage tries of an account.
+func diffStorage(db Database, addrHash, rootA, rootB common.Hash) ([]StorageDiff, error) {
+	trA, err := db.OpenStorageTrie(addrHash, rootA)
+	if err != nil {
+		return nil, err
+	}
+	trB, err := db.OpenStorageTrie(addrHash, rootB)
+	if err != nil {
+		return nil, err
+	}
+	prev, post, err := diffLeaves(trA, trB)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []StorageDiff
+	for _, hash := range sortedKeys(prev, post) {
+		diff := StorageDiff{KeyHash: hash}
+		if preimage := trA.GetKey(hash[:]); preimage != nil {
+			diff.Key = common.BytesToHash(preimage)
+		} else if preimage := trB.GetKey(hash[:]); preimage != nil {
+			diff.Key = common.BytesToHash(preimage)
+		}
+		if diff.Prev, err = decodeSlot(prev[hash]); err != nil {
+			return nil, err
+		}
+		if diff.Value, err = decodeSlot(post[hash]); err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// diffLeaves returns the leaves of a missing from b and the leaves of b missing
+// from a, keyed by their hashed keys. A key present in both results has a
+// changed value.
+func diffLeaves(a, b Trie) (prev, post map[common.Hash][]byte, err error) {
+	collect := func(from, to Trie) (map[common.Hash][]byte, error) {
+		diff, _ := trie.NewDifferenceIterator(from.NodeIterator(nil), to.NodeIterator(nil))
+		it := trie.NewIterator(diff)
+		leaves := make(map[common.Hash][]byte)
+		for it.Next() {
+			leaves[common.BytesToHash(it.Key)] = it.Value
+		}
+		return leaves, it.Err
+	}
+	if prev, err = collect(b, a); err != nil {
+		return nil, nil, err
+	}
+	if post, err = collect(a, b); err != nil {
+		return nil, nil, err
+	}
+	// Leaves can be reported when only their position in the trie changed
+	for hash, value := range prev {
+		if bytes.Equal(post[hash], value) {
+			delete(prev, hash)
+			delete(post, hash)
+		}
+	}
+	return prev, post, nil
+}
+
+// sortedKeys returns the union of the keys of both maps in ascending order.
+func sortedKeys(a, b map[common.Hash][]byte) []common.Hash {
+	keys := make([]common.Hash, 0, len(a)+len(b))
+	for hash := range a {
+		keys = append(keys, hash)
+	}
+	for hash := range b {
+		if _, ok := a[hash]; !ok {
+			keys = append(keys, hash)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+	return keys
+}
+
+// decodeSlot decodes a storage trie value, nil for a missing slot.
+func decodeSlot(enc []byte) (common.Hash, error) {
+	if len(enc) == 0 {
+		return common.Hash{}, nil
+	}
+	_, content, _, err := rlp.Split(enc)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(content), nil
+}
+
+// String renders the changes of the account in a human readable form, one
+// changed field per line. Unresolved addresses and slot keys are shown as
+// their hashes prefixed with '#'.
+func (d *AccountDiff) String() string {
+	var b strings.Builder
+	if crypto.Keccak256Hash(d.Address[:]) == d.AddrHash {
+		fmt.Fprintf(&b, "account %x", d.Address)
+	} else {
+		fmt.Fprintf(&b, "account #%x", d.AddrHash)
+	}
+	switch {
+	case d.Created:
+		b.WriteString(" (created)")
+	case d.Deleted:
+		b.WriteString(" (deleted)")
+	}
+	b.WriteString("\n")
+	if d.PrevBalance.Cmp(d.Balance) != 0 {
+		fmt.Fprintf(&b, "  balance: %v -> %v\n", d.PrevBalance, d.Balance)
+	}
+	if d.PrevNonce != d.Nonce {
+		fmt.Fprintf(&b, "  nonce: %d -> %d\n", d.PrevNonce, d.Nonce)
+	}
+	if d.PrevCodeHash != d.CodeHash {
+		fmt.Fprintf(&b, "  codehash: %x -> %x\n", d.PrevCodeHash, d.CodeHash)
+	}
+	for _, slot := range d.Storage {
+		if crypto.Keccak256Hash(slot.Key[:]) == slot.KeyHash {
+			fmt.Fprintf(&b, "  storage %x: %x -> %x\n", slot.Key, slot.Prev, slot.Value)
+		} else {
+			fmt.Fprintf(&b, "  storage #%x: %x -> %x\n", slot.KeyHash, slot.Prev, slot.Value)
+		}
+	}
+	return b.String()
+}
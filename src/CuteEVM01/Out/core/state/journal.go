@@ -20,6 +20,7 @@ import (
 	"math/big"
 
 	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/types"
 )
 
 // journalEntry is a modification entry in the state change journal that can be
@@ -30,6 +31,11 @@ type journalEntry interface {
 
 	// dirtied returns the Ethereum address modified by this journal entry.
 	dirtied() *common.Address
+
+	// changes describes the modifications of this journal entry for the
+	// change log returned by StateDB.Changes. Snapshot ids are filled in by
+	// the caller.
+	changes(*StateDB) []StateChange
 }
 
 // journal contains the list of state modifications applied since the last state
@@ -100,28 +106,30 @@ type (
 
 	// Changes to individual accounts.
 	balanceChange struct {
-		account *common.Address
-		prev    *big.Int
+		account     *common.Address
+		prev, value *big.Int
 	}
 	nonceChange struct {
-		account *common.Address
-		prev    uint64
+		account     *common.Address
+		prev, value uint64
 	}
 	storageChange struct {
-		account       *common.Address
-		key, prevalue common.Hash
+		account              *common.Address
+		key, prevalue, value common.Hash
 	}
 	codeChange struct {
 		account            *common.Address
 		prevcode, prevhash []byte
+		code, hash         []byte
 	}
 
 	// Changes to other state values.
 	refundChange struct {
-		prev uint64
+		prev, value uint64
 	}
 	addLogChange struct {
 		txhash common.Hash
+		log    *types.Log
 	}
 	addPreimageChange struct {
 		hash common.Hash
@@ -131,6 +139,19 @@ type (
 		prev      bool
 		prevDirty bool
 	}
+	transientStorageChange struct {
+		account              *common.Address
+		key, prevalue, value common.Hash
+	}
+
+	// Changes to the access list
+	accessListAddAccountChange struct {
+		address *common.Address
+	}
+	accessListAddSlotChange struct {
+		address *common.Address
+		slot    *common.Hash
+	}
 )
 
 func (ch createObjectChange) revert(s *StateDB) {
@@ -142,6 +163,10 @@ func (ch createObjectChange) dirtied() *common.Address {
 	return ch.account
 }
 
+func (ch createObjectChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: *ch.account, Field: ChangeCreate, Prev: false, New: true}}
+}
+
 func (ch resetObjectChange) revert(s *StateDB) {
 	s.setStateObject(ch.prev)
 }
@@ -150,6 +175,10 @@ func (ch resetObjectChange) dirtied() *common.Address {
 	return nil
 }
 
+func (ch resetObjectChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: ch.prev.address, Field: ChangeCreate, Prev: true, New: true}}
+}
+
 func (ch suicideChange) revert(s *StateDB) {
 	obj := s.getStateObject(*ch.account)
 	if obj != nil {
@@ -162,6 +191,14 @@ func (ch suicideChange) dirtied() *common.Address {
 	return ch.account
 }
 
+func (ch suicideChange) changes(s *StateDB) []StateChange {
+	// Suicide also burns the remaining balance of the account
+	return []StateChange{
+		{Address: *ch.account, Field: ChangeSuicide, Prev: ch.prev, New: true},
+		{Address: *ch.account, Field: ChangeBalance, Prev: new(big.Int).Set(ch.prevbalance), New: new(big.Int)},
+	}
+}
+
 var ripemd = common.HexToAddress("0000000000000000000000000000000000000003")
 
 func (ch touchChange) revert(s *StateDB) {
@@ -171,6 +208,10 @@ func (ch touchChange) dirtied() *common.Address {
 	return ch.account
 }
 
+func (ch touchChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: *ch.account, Field: ChangeTouch}}
+}
+
 func (ch balanceChange) revert(s *StateDB) {
 	s.getStateObject(*ch.account).setBalance(ch.prev)
 }
@@ -179,6 +220,10 @@ func (ch balanceChange) dirtied() *common.Address {
 	return ch.account
 }
 
+func (ch balanceChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: *ch.account, Field: ChangeBalance, Prev: new(big.Int).Set(ch.prev), New: new(big.Int).Set(ch.value)}}
+}
+
 func (ch nonceChange) revert(s *StateDB) {
 	s.getStateObject(*ch.account).setNonce(ch.prev)
 }
@@ -187,6 +232,10 @@ func (ch nonceChange) dirtied() *common.Address {
 	return ch.account
 }
 
+func (ch nonceChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: *ch.account, Field: ChangeNonce, Prev: ch.prev, New: ch.value}}
+}
+
 func (ch codeChange) revert(s *StateDB) {
 	s.getStateObject(*ch.account).setCode(common.BytesToHash(ch.prevhash), ch.prevcode)
 }
@@ -195,6 +244,10 @@ func (ch codeChange) dirtied() *common.Address {
 	return ch.account
 }
 
+func (ch codeChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: *ch.account, Field: ChangeCode, Prev: common.CopyBytes(ch.prevcode), New: common.CopyBytes(ch.code)}}
+}
+
 func (ch storageChange) revert(s *StateDB) {
 	s.getStateObject(*ch.account).setState(ch.key, ch.prevalue)
 }
@@ -203,6 +256,10 @@ func (ch storageChange) dirtied() *common.Address {
 	return ch.account
 }
 
+func (ch storageChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: *ch.account, Field: ChangeStorage, Key: ch.key, Prev: ch.prevalue, New: ch.value}}
+}
+
 func (ch refundChange) revert(s *StateDB) {
 	s.refund = ch.prev
 }
@@ -211,6 +268,10 @@ func (ch refundChange) dirtied() *common.Address {
 	return nil
 }
 
+func (ch refundChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Field: ChangeRefund, Prev: ch.prev, New: ch.value}}
+}
+
 func (ch addLogChange) revert(s *StateDB) {
 	logs := s.logs[ch.txhash]
 	if len(logs) == 1 {
@@ -225,6 +286,10 @@ func (ch addLogChange) dirtied() *common.Address {
 	return nil
 }
 
+func (ch addLogChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: ch.log.Address, Field: ChangeLog, New: ch.log}}
+}
+
 func (ch addPreimageChange) revert(s *StateDB) {
 	delete(s.preimages, ch.hash)
 }
@@ -232,3 +297,52 @@ func (ch addPreimageChange) revert(s *StateDB) {
 func (ch addPreimageChange) dirtied() *common.Address {
 	return nil
 }
+
+func (ch addPreimageChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Field: ChangePreimage, Key: ch.hash, New: common.CopyBytes(s.preimages[ch.hash])}}
+}
+
+func (ch transientStorageChange) revert(s *StateDB) {
+	s.setTransientState(*ch.account, ch.key, ch.prevalue)
+}
+
+func (ch transientStorageChange) dirtied() *common.Address {
+	return nil
+}
+
+func (ch transientStorageChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: *ch.account, Field: ChangeTransientStorage, Key: ch.key, Prev: ch.prevalue, New: ch.value}}
+}
+
+func (ch accessListAddAccountChange) revert(s *StateDB) {
+	/*
+		One important invariant here, is that whenever a (addr, slot) is added, if the
+		addr is not already present, the add causes two journal entries:
+		- one for the address,
+		- one for the (address,slot)
+		Therefore, when unrolling the change, we can always blindly delete the
+		(addr) at this point, since no storage adds can remain when come upon
+		a single (addr) change.
+	*/
+	s.accessList.DeleteAddress(*ch.address)
+}
+
+func (ch accessListAddAccountChange) dirtied() *common.Address {
+	return nil
+}
+
+func (ch accessListAddAccountChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: *ch.address, Field: ChangeAccessListAddress, Prev: false, New: true}}
+}
+
+func (ch accessListAddSlotChange) revert(s *StateDB) {
+	s.accessList.DeleteSlot(*ch.address, *ch.slot)
+}
+
+func (ch accessListAddSlotChange) dirtied() *common.Address {
+	return nil
+}
+
+func (ch accessListAddSlotChange) changes(s *StateDB) []StateChange {
+	return []StateChange{{Address: *ch.address, Field: ChangeAccessListSlot, Key: *ch.slot, Prev: false, New: true}}
+}
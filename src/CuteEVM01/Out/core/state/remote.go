@@ -0,0 +1,281 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"sync"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/crypto"
+	"CuteEVM01/Out/ethdb"
+	"CuteEVM01/Out/rlp"
+	"CuteEVM01/Out/trie"
+)
+
+var (
+	// remoteTombstone marks locally deleted keys in the local tries. It is no
+	// valid account encoding, and as a storage value it encodes a zero slot,
+	// which the state deletes instead of writing. Iterators skip it.
+	remoteTombstone = []byte{0x00}
+
+	// remoteLocalKey marks the storage tries of accounts created locally, whose
+	// storage must not fall back to the remote one. The key is shorter than a
+	// storage slot, so it never collides with one, and is hidden from iterators.
+	remoteLocalKey  = []byte("remote-local")
+	remoteLocalHash = crypto.Keccak256(remoteLocalKey)
+
+	remoteAccountPrefix = []byte("remote-account-") // remoteAccountPrefix + block (uint64 big endian) + address -> account RLP
+	remoteStoragePrefix = []byte("remote-storage-") // remoteStoragePrefix + block (uint64 big endian) + address + slot -> value
+	remoteAddressPrefix = []byte("remote-address-") // remoteAddressPrefix + address hash -> address
+)
+
+// RemoteBackend retrieves the state of a pinned block from a remote node.
+type RemoteBackend interface {
+	// Block returns the number of the pinned block.
+	Block() uint64
+
+	// Account retrieves the nonce, balance and code of an account. Accounts
+	// that do not exist are reported with zero values.
+	Account(addr common.Address) (nonce uint64, balance *big.Int, code []byte, err error)
+
+	// Storage retrieves the value of a storage slot.
+	Storage(addr common.Address, slot common.Hash) (common.Hash, error)
+}
+
+// remoteDatabase is a state database forking off a remote chain. Tries only
+// hold the locally modified state; everything missing from them is fetched
+// from the remote backend on first access and cached in the local database,
+// so reruns against the same database do not hit the network again.
+//
+// State roots computed on top of a remote database cover the local changes
+// only and have no relation to the roots of the remote chain.
+type remoteDatabase struct {
+	Database
+	diskdb  ethdb.Database
+	backend RemoteBackend
+
+	lock      sync.Mutex
+	addresses map[common.Hash]common.Address // address preimages of accessed accounts, also persisted in diskdb
+}
+
+// NewRemoteDatabase creates a state database that lazily loads accounts,
+// code and storage missing locally from the given backend. Fetched data is
+// cached in db. Open the state at the empty root to start from the remote
+// block itself.
+func NewRemoteDatabase(db ethdb.Database, backend RemoteBackend) Database {
+	return &remoteDatabase{
+		Database:  NewDatabase(db),
+		diskdb:    db,
+		backend:   backend,
+		addresses: make(map[common.Hash]common.Address),
+	}
+}
+
+// OpenTrie opens the main account trie at a specific root hash.
+func (db *remoteDatabase) OpenTrie(root common.Hash) (Trie, error) {
+	tr, err := db.Database.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteTrie{Trie: tr, fetch: db.account}, nil
+}
+
+// OpenStorageTrie opens the storage trie of an account. Accounts created
+// locally, either new or replacing a remote account through self-destruction
+// or CREATE, start from the zero root; their storage tries are marked as local
+// and never fall back to the remote storage, also after they are committed.
+func (db *remoteDatabase) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
+	tr, err := db.Database.OpenStorageTrie(addrHash, root)
+	if err != nil {
+		return nil, err
+	}
+	fetch := func(key []byte) ([]byte, error) { return nil, nil }
+	if root == (common.Hash{}) {
+		if err := tr.TryUpdate(remoteLocalKey, []byte{0x01}); err != nil {
+			return nil, err
+		}
+		return &remoteTrie{Trie: tr, fetch: fetch}, nil
+	}
+	if local, err := tr.TryGet(remoteLocalKey); err != nil {
+		return nil, err
+	} else if len(local) > 0 {
+		return &remoteTrie{Trie: tr, fetch: fetch}, nil
+	}
+	if addr, ok := db.address(addrHash); ok {
+		fetch = func(key []byte) ([]byte, error) { return db.storage(addr, common.BytesToHash(key)) }
+	}
+	return &remoteTrie{Trie: tr, fetch: fetch}, nil
+}
+
+// address returns the address with the given hash. The mapping is recorded
+// on first access of an account and persisted, so storage of accounts loaded
+// from a committed local trie can still be fetched in later runs.
+func (db *remoteDatabase) address(addrHash common.Hash) (common.Address, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if addr, ok := db.addresses[addrHash]; ok {
+		return addr, true
+	}
+	enc, _ := db.diskdb.Get(append(common.CopyBytes(remoteAddressPrefix), addrHash[:]...))
+	if len(enc) != common.AddressLength {
+		return common.Address{}, false
+	}
+	addr := common.BytesToAddress(enc)
+	db.addresses[addrHash] = addr
+	return addr, true
+}
+
+// recordAddress remembers the preimage of an address hash.
+func (db *remoteDatabase) recordAddress(addr common.Address) error {
+	addrHash := crypto.Keccak256Hash(addr[:])
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if _, ok := db.addresses[addrHash]; ok {
+		return nil
+	}
+	if err := db.diskdb.Put(append(common.CopyBytes(remoteAddressPrefix), addrHash[:]...), addr[:]); err != nil {
+		return err
+	}
+	db.addresses[addrHash] = addr
+	return nil
+}
+
+// CopyTrie returns an independent copy of the given trie.
+func (db *remoteDatabase) CopyTrie(t Trie) Trie {
+	rt, ok := t.(*remoteTrie)
+	if !ok {
+		return db.Database.CopyTrie(t)
+	}
+	return &remoteTrie{Trie: db.Database.CopyTrie(rt.Trie), fetch: rt.fetch}
+}
+
+// account returns the RLP encoded account of the pinned block, or nil if it
+// does not exist. The account code is stored in the local database keyed by
+// its hash, where ContractCode finds it.
+func (db *remoteDatabase) account(key []byte) ([]byte, error) {
+	addr := common.BytesToAddress(key)
+	if err := db.recordAddress(addr); err != nil {
+		return nil, err
+	}
+
+	cacheKey := db.cacheKey(remoteAccountPrefix, addr[:])
+	enc, _ := db.diskdb.Get(cacheKey)
+	if len(enc) == 0 {
+		nonce, balance, code, err := db.backend.Account(addr)
+		if err != nil {
+			return nil, err
+		}
+		if balance == nil {
+			balance = new(big.Int)
+		}
+		codeHash := crypto.Keccak256Hash(code)
+		if len(code) > 0 {
+			if err := db.diskdb.Put(codeHash[:], code); err != nil {
+				return nil, err
+			}
+		}
+		if enc, err = rlp.EncodeToBytes(Account{Nonce: nonce, Balance: balance, Root: emptyRoot, CodeHash: codeHash[:]}); err != nil {
+			return nil, err
+		}
+		if err := db.diskdb.Put(cacheKey, enc); err != nil {
+			return nil, err
+		}
+	}
+	var account Account
+	if err := rlp.DecodeBytes(enc, &account); err != nil {
+		return nil, err
+	}
+	if account.Nonce == 0 && account.Balance.Sign() == 0 && bytes.Equal(account.CodeHash, emptyCode[:]) {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// storage returns the RLP encoded value of a storage slot of the pinned block,
+// or nil if the slot is empty.
+func (db *remoteDatabase) storage(addr common.Address, slot common.Hash) ([]byte, error) {
+	cacheKey := db.cacheKey(remoteStoragePrefix, addr[:], slot[:])
+	value, _ := db.diskdb.Get(cacheKey)
+	if len(value) == 0 {
+		remote, err := db.backend.Storage(addr, slot)
+		if err != nil {
+			return nil, err
+		}
+		value = remote[:]
+		if err := db.diskdb.Put(cacheKey, value); err != nil {
+			return nil, err
+		}
+	}
+	value = bytes.TrimLeft(value, "\x00")
+	if len(value) == 0 {
+		return nil, nil
+	}
+	return rlp.EncodeToBytes(value)
+}
+
+// cacheKey assembles the local cache key of some remote data of the pinned block.
+func (db *remoteDatabase) cacheKey(prefix []byte, parts ...[]byte) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], db.backend.Block())
+	for _, part := range parts {
+		key = append(key, part...)
+	}
+	return key
+}
+
+// remoteTrie is a local trie falling back to remote data for keys it does not
+// contain. Deleting a key stores a tombstone in the local trie instead, so the
+// remote value stays hidden in every state committed on top of it, while
+// states committed before the deletion still see it.
+type remoteTrie struct {
+	Trie
+	fetch func(key []byte) ([]byte, error)
+}
+
+// TryGet returns the value for key stored in the local trie, nil if it was
+// deleted locally, or the remote value if the key was never written locally.
+func (t *remoteTrie) TryGet(key []byte) ([]byte, error) {
+	enc, err := t.Trie.TryGet(key)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(enc, remoteTombstone) {
+		return nil, nil
+	}
+	if len(enc) > 0 {
+		return enc, nil
+	}
+	return t.fetch(key)
+}
+
+// TryDelete replaces the value of key in the local trie with a tombstone.
+func (t *remoteTrie) TryDelete(key []byte) error {
+	return t.Trie.TryUpdate(key, remoteTombstone)
+}
+
+// NodeIterator returns an iterator over the local trie that skips tombstones
+// and the local storage marker.
+func (t *remoteTrie) NodeIterator(start []byte) trie.NodeIterator {
+	return &remoteIterator{t.Trie.NodeIterator(start)}
+}
+
+// remoteIterator is a node iterator hiding the tombstone and marker leaves of
+// a local trie.
+type remoteIterator struct {
+	trie.NodeIterator
+}
+
+// Next moves the iterator to the next node that is not a hidden leaf.
+func (it *remoteIterator) Next(descend bool) bool {
+	for it.NodeIterator.Next(descend) {
+		if !it.Leaf() || (!bytes.Equal(it.LeafBlob(), remoteTombstone) && !bytes.Equal(it.LeafKey(), remoteLocalHash)) {
+			return true
+		}
+	}
+	return false
+}
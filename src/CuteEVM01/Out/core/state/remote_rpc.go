@@ -0,0 +1,125 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/hexutil"
+)
+
+// RPCBackend is a RemoteBackend retrieving state from an Ethereum JSON-RPC
+// endpoint over HTTP, using eth_getBalance, eth_getTransactionCount,
+// eth_getCode and eth_getStorageAt at the pinned block.
+type RPCBackend struct {
+	endpoint string
+	block    uint64
+	client   *http.Client
+	id       uint64
+}
+
+// NewRPCBackend creates a backend for the given endpoint pinned at block. If
+// block is nil, the latest block reported by the endpoint is pinned.
+func NewRPCBackend(endpoint string, block *big.Int) (*RPCBackend, error) {
+	b := &RPCBackend{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if block != nil {
+		if !block.IsUint64() {
+			return nil, fmt.Errorf("invalid block number %v", block)
+		}
+		b.block = block.Uint64()
+		return b, nil
+	}
+	var latest hexutil.Uint64
+	if err := b.call(&latest, "eth_blockNumber"); err != nil {
+		return nil, err
+	}
+	b.block = uint64(latest)
+	return b, nil
+}
+
+// Block returns the number of the pinned block.
+func (b *RPCBackend) Block() uint64 {
+	return b.block
+}
+
+// Account retrieves the nonce, balance and code of an account.
+func (b *RPCBackend) Account(addr common.Address) (uint64, *big.Int, []byte, error) {
+	var (
+		balance hexutil.Big
+		nonce   hexutil.Uint64
+		code    hexutil.Bytes
+		block   = hexutil.EncodeUint64(b.block)
+	)
+	if err := b.call(&balance, "eth_getBalance", addr, block); err != nil {
+		return 0, nil, nil, err
+	}
+	if err := b.call(&nonce, "eth_getTransactionCount", addr, block); err != nil {
+		return 0, nil, nil, err
+	}
+	if err := b.call(&code, "eth_getCode", addr, block); err != nil {
+		return 0, nil, nil, err
+	}
+	return uint64(nonce), (*big.Int)(&balance), code, nil
+}
+
+// Storage retrieves the value of a storage slot.
+func (b *RPCBackend) Storage(addr common.Address, slot common.Hash) (common.Hash, error) {
+	var value hexutil.Bytes
+	if err := b.call(&value, "eth_getStorageAt", addr, slot, hexutil.EncodeUint64(b.block)); err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(value), nil
+}
+
+type rpcRequest struct {
+	Version string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// call performs a JSON-RPC request and decodes its result into result.
+func (b *RPCBackend) call(result interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(rpcRequest{Version: "2.0", ID: atomic.AddUint64(&b.id, 1), Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Post(b.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s failed: %s", method, resp.Status)
+	}
+	var response rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("%s failed: invalid response: %v", method, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s failed: %s (code %d)", method, response.Error.Message, response.Error.Code)
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("%s failed: invalid result: %v", method, err)
+	}
+	return nil
+}
@@ -212,6 +212,7 @@ func (s *stateObject) SetState(db Database, key, value common.Hash) {
 		account:  &s.address,
 		key:      key,
 		prevalue: prev,
+		value:    value,
 	})
 	s.setState(key, value)
 }
@@ -305,6 +306,7 @@ func (s *stateObject) SetBalance(amount *big.Int) {
 	s.db.journal.append(balanceChange{
 		account: &s.address,
 		prev:    new(big.Int).Set(s.data.Balance),
+		value:   new(big.Int).Set(amount),
 	})
 	s.setBalance(amount)
 }
@@ -361,6 +363,8 @@ func (s *stateObject) SetCode(codeHash common.Hash, code []byte) {
 		account:  &s.address,
 		prevhash: s.CodeHash(),
 		prevcode: prevcode,
+		hash:     codeHash[:],
+		code:     code,
 	})
 	s.setCode(codeHash, code)
 }
@@ -375,6 +379,7 @@ func (s *stateObject) SetNonce(nonce uint64) {
 	s.db.journal.append(nonceChange{
 		account: &s.address,
 		prev:    s.data.Nonce,
+		value:   nonce,
 	})
 	s.setNonce(nonce)
 }
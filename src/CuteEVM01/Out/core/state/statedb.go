@@ -87,12 +87,23 @@ type StateDB struct {
 
 	preimages map[common.Hash][]byte
 
+	// Per-transaction access list
+	accessList *accessList
+
+	// Transient storage (EIP-1153), cleared after every top-level execution
+	transientStorage transientStorage
+
 	// Journal of state modifications. This is the backbone of
 	// Snapshot and RevertToSnapshot.
 	journal        *journal
 	validRevisions []revision
 	nextRevisionId int
 
+	// Change log of finalised modifications per transaction hash, kept while
+	// recordChanges is set. See RecordChanges.
+	recordChanges bool
+	changeLog     map[common.Hash][]StateChange
+
 	// Measurements gathered during execution for debugging purposes
 	AccountReads   time.Duration
 	AccountHashes  time.Duration
@@ -118,6 +129,8 @@ func New(root common.Hash, db Database) (*StateDB, error) {
 		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
 		journal:           newJournal(),
+		accessList:        newAccessList(),
+		transientStorage:  newTransientStorage(),
 	}, nil
 }
 
@@ -139,6 +152,9 @@ func (self *StateDB) Reset(root common.Hash) error {
 	if err != nil {
 		return err
 	}
+	// Clear the journal first, so a recorded change log is filed under the
+	// current transaction before its context is reset
+	self.clearJournalAndRefund()
 	self.trie = tr
 	self.stateObjects = make(map[common.Address]*stateObject)
 	self.stateObjectsDirty = make(map[common.Address]struct{})
@@ -148,12 +164,11 @@ func (self *StateDB) Reset(root common.Hash) error {
 	self.logs = make(map[common.Hash][]*types.Log)
 	self.logSize = 0
 	self.preimages = make(map[common.Hash][]byte)
-	self.clearJournalAndRefund()
 	return nil
 }
 
 func (self *StateDB) AddLog(log *types.Log) {
-	self.journal.append(addLogChange{txhash: self.thash})
+	self.journal.append(addLogChange{txhash: self.thash, log: log})
 
 	log.TxHash = self.thash
 	log.BlockHash = self.bhash
@@ -192,17 +207,17 @@ func (self *StateDB) Preimages() map[common.Hash][]byte {
 
 // AddRefund adds gas to the refund counter
 func (self *StateDB) AddRefund(gas uint64) {
-	self.journal.append(refundChange{prev: self.refund})
+	self.journal.append(refundChange{prev: self.refund, value: self.refund + gas})
 	self.refund += gas
 }
 
 // SubRefund removes gas from the refund counter.
 // This method will panic if the refund counter goes below zero
 func (self *StateDB) SubRefund(gas uint64) {
-	self.journal.append(refundChange{prev: self.refund})
 	if gas > self.refund {
 		panic("Refund counter below zero")
 	}
+	self.journal.append(refundChange{prev: self.refund, value: self.refund - gas})
 	self.refund -= gas
 }
 
@@ -590,6 +605,13 @@ func (self *StateDB) Copy() *StateDB {
 	for hash, preimage := range self.preimages {
 		state.preimages[hash] = preimage
 	}
+	// The access list is per-transaction, but copies taken in the middle of a
+	// transaction (e.g. by tracers) must still see the same warm/cold status.
+	state.accessList = self.accessList.Copy()
+	state.transientStorage = self.transientStorage.Copy()
+
+	state.recordChanges = self.recordChanges
+	state.changeLog = copyChangeLog(self.changeLog)
 	return state
 }
 
@@ -670,7 +692,92 @@ func (self *StateDB) Prepare(thash, bhash common.Hash, ti int) {
 	self.txIndex = ti
 }
 
+// PrepareAccessList handles the preparatory steps for executing a state transition
+// with regards to EIP-2929: it clears the access list left over from a previous
+// transaction and adds the sender, the destination (if any) and the precompiles.
+func (s *StateDB) PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address) {
+	s.accessList = newAccessList()
+
+	s.AddAddressToAccessList(sender)
+	if dst != nil {
+		s.AddAddressToAccessList(*dst)
+	}
+	for _, addr := range precompiles {
+		s.AddAddressToAccessList(addr)
+	}
+}
+
+// AddAddressToAccessList adds the given address to the access list
+func (s *StateDB) AddAddressToAccessList(addr common.Address) {
+	if s.accessList.AddAddress(addr) {
+		s.journal.append(accessListAddAccountChange{&addr})
+	}
+}
+
+// AddSlotToAccessList adds the given (address, slot)-tuple to the access list
+func (s *StateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	addrMod, slotMod := s.accessList.AddSlot(addr, slot)
+	if addrMod {
+		// In practice, this should not happen, since there is no way to enter the
+		// scope of 'address' without having the 'address' become already added
+		// to the access list (via call-variant, create, etc).
+		// Better safe than sorry, though
+		s.journal.append(accessListAddAccountChange{&addr})
+	}
+	if slotMod {
+		s.journal.append(accessListAddSlotChange{
+			address: &addr,
+			slot:    &slot,
+		})
+	}
+}
+
+// AddressInAccessList returns true if the given address is in the access list.
+func (s *StateDB) AddressInAccessList(addr common.Address) bool {
+	return s.accessList.ContainsAddress(addr)
+}
+
+// SlotInAccessList returns true if the given (address, slot)-tuple is in the access list.
+func (s *StateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressPresent bool, slotPresent bool) {
+	return s.accessList.Contains(addr, slot)
+}
+
+// SetTransientState sets transient storage for a given account. It
+// adds the change to the journal so that it can be rolled back
+// to its previous value if there is a revert.
+func (s *StateDB) SetTransientState(addr common.Address, key, value common.Hash) {
+	prev := s.GetTransientState(addr, key)
+	if prev == value {
+		return
+	}
+	s.journal.append(transientStorageChange{
+		account:  &addr,
+		key:      key,
+		prevalue: prev,
+		value:    value,
+	})
+	s.setTransientState(addr, key, value)
+}
+
+// setTransientState is a lower level setter for transient storage. It
+// is called during a revert to prevent modifications to the journal.
+func (s *StateDB) setTransientState(addr common.Address, key, value common.Hash) {
+	s.transientStorage.Set(addr, key, value)
+}
+
+// GetTransientState gets transient storage for a given account.
+func (s *StateDB) GetTransientState(addr common.Address, key common.Hash) common.Hash {
+	return s.transientStorage.Get(addr, key)
+}
+
+// ClearTransientStorage discards all transient storage. It is called at the
+// end of every top-level execution, the cleared values can't be reverted.
+func (s *StateDB) ClearTransientStorage() {
+	s.transientStorage = newTransientStorage()
+}
+
 func (s *StateDB) clearJournalAndRefund() {
+	s.flushChanges()
 	s.journal = newJournal()
 	s.validRevisions = s.validRevisions[:0]
 	s.refund = 0
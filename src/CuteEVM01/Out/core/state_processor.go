@@ -0,0 +1,114 @@
+// 实现区块的处理: 依次执行区块中的交易，生成收据并应用共识引擎的区块奖励
+package core
+
+import (
+	"CuteEVM01"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/consensus"
+	"CuteEVM01/Out/consensus/misc"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/core/types"
+	"CuteEVM01/Out/crypto"
+	"CuteEVM01/Out/params"
+)
+
+// StateProcessor 是一个基本的处理器，负责将状态从一个点转换到另一个点。
+type StateProcessor struct {
+	config *params.ChainConfig   // 链配置选项
+	bc     consensus.ChainReader // 规范区块链
+	engine consensus.Engine      // 用于区块奖励的共识引擎
+}
+
+// NewStateProcessor 初始化一个新的 StateProcessor
+func NewStateProcessor(config *params.ChainConfig, bc consensus.ChainReader, engine consensus.Engine) *StateProcessor {
+	return &StateProcessor{
+		config: config,
+		bc:     bc,
+		engine: engine,
+	}
+}
+
+// chainContext 将链读取器和共识引擎组合成EVM所需的 ChainContext
+type chainContext struct {
+	consensus.ChainReader
+	engine consensus.Engine
+}
+
+// Engine 返回链的共识引擎
+func (c chainContext) Engine() consensus.Engine { return c.engine }
+
+// Process 通过使用statedb运行交易消息并对处理者(coinbase)和所有叔块的处理者应用奖励，
+// 根据以太坊规则处理状态变化。
+//
+// Process 返回处理过程中累积的收据和日志，并返回处理过程中使用的gas数量。
+// 如果任何一笔交易由于gas不足而执行失败，它将返回一个错误。
+func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	var (
+		receipts types.Receipts
+		usedGas  = new(uint64)
+		header   = block.Header()
+		allLogs  []*types.Log
+		gp       = new(GasPool).AddGas(block.GasLimit())
+	)
+	// 根据任何硬分叉规范改变区块和状态
+	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	// 遍历并处理单个交易
+	for i, tx := range block.Transactions() {
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		receipt, err := ApplyTransaction(p.config, chainContext{p.bc, p.engine}, nil, gp, statedb, header, tx, usedGas, cfg)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+	}
+	// 完成区块，应用任何共识引擎特定的额外操作(例如区块奖励)
+	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles())
+
+	return receipts, allLogs, *usedGas, nil
+}
+
+// ApplyTransaction 尝试将交易应用到给定的状态数据库，并使用输入参数作为其环境。
+// 它返回交易的收据和使用的gas，如果交易失败，则返回一个错误，表明该区块无效。
+func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
+	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number))
+	if err != nil {
+		return nil, err
+	}
+	// 创建一个在EVM环境中使用的新上下文
+	context := NewEVMContext(msg, header, bc, author)
+	// 创建一个新的环境，其中包含关于交易和调用机制的所有相关信息
+	vmenv := vm.NewEVM(context, statedb, config, cfg)
+	// 将交易应用于当前状态(包含在env中)
+	_, gas, failed, err := ApplyMessage(vmenv, msg, gp)
+	if err != nil {
+		return nil, err
+	}
+	// 用待处理的更改更新状态
+	var root []byte
+	if config.IsByzantium(header.Number) {
+		statedb.Finalise(true)
+	} else {
+		root = statedb.IntermediateRoot(config.IsEIP158(header.Number)).Bytes()
+	}
+	*usedGas += gas
+
+	// 为交易创建一个新的收据，存储中间根和交易使用的gas
+	receipt := types.NewReceipt(root, failed, *usedGas)
+	receipt.TxHash = tx.Hash()
+	receipt.GasUsed = gas
+	// 如果交易创建了合约，则将创建地址存储在收据中
+	if msg.To() == nil {
+		receipt.ContractAddress = crypto.CreateAddress(vmenv.Context.Origin, tx.Nonce())
+	}
+	// 设置收据日志并创建bloom过滤器
+	receipt.Logs = statedb.GetLogs(tx.Hash())
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	receipt.BlockHash = statedb.BlockHash()
+	receipt.BlockNumber = header.Number
+	receipt.TransactionIndex = uint(statedb.TxIndex())
+
+	return receipt, err
+}
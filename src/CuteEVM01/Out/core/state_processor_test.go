@@ -0,0 +1,92 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"CuteEVM01"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/consensus"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/core/types"
+	"CuteEVM01/Out/crypto"
+	"CuteEVM01/Out/params"
+)
+
+// testEngine 是只实现处理区块所需方法的共识引擎，区块奖励固定为 testReward
+type testEngine struct {
+	consensus.Engine
+}
+
+var testReward = big.NewInt(2000)
+
+func (testEngine) Author(header *types.Header) (common.Address, error) {
+	return header.Coinbase, nil
+}
+
+func (testEngine) Finalize(chain consensus.ChainReader, header *types.Header, statedb *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
+	statedb.AddBalance(header.Coinbase, testReward)
+	header.Root = statedb.IntermediateRoot(true)
+}
+
+func TestStateProcessor(t *testing.T) {
+	var (
+		key, _     = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender     = crypto.PubkeyToAddress(key.PublicKey)
+		config     = params.AllEthashProtocolChanges
+		signer     = types.MakeSigner(config, new(big.Int))
+		statedb, _ = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	)
+	statedb.SetBalance(sender, big.NewInt(1000000000))
+	// 合约发出一条无主题的LOG0
+	statedb.SetCode(testContract, []byte{byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.LOG0)})
+	statedb.Finalise(true)
+
+	tx1, _ := types.SignTx(types.NewTransaction(0, testContract, new(big.Int), 50000, big.NewInt(1), nil), signer, key)
+	tx2, _ := types.SignTx(types.NewContractCreation(1, new(big.Int), 100000, big.NewInt(1), nil), signer, key)
+
+	header := &types.Header{
+		Number:     new(big.Int),
+		Difficulty: new(big.Int),
+		GasLimit:   1000000,
+		Coinbase:   testCoinbase,
+	}
+	block := types.NewBlock(header, []*types.Transaction{tx1, tx2}, nil, nil)
+
+	receipts, logs, usedGas, err := NewStateProcessor(config, nil, testEngine{}).Process(block, statedb, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("receipt count mismatch: have %d, want 2", len(receipts))
+	}
+	if len(logs) != 1 || logs[0].Address != testContract || logs[0].TxHash != tx1.Hash() {
+		t.Errorf("unexpected logs: %v", logs)
+	}
+	if !types.BloomLookup(receipts[0].Bloom, testContract) {
+		t.Error("receipt bloom does not contain the log address")
+	}
+	if receipts[1].CumulativeGasUsed != usedGas || receipts[0].GasUsed+receipts[1].GasUsed != usedGas {
+		t.Errorf("cumulative gas mismatch: %d + %d != %d", receipts[0].GasUsed, receipts[1].GasUsed, usedGas)
+	}
+	if want := crypto.CreateAddress(sender, 1); receipts[1].ContractAddress != want {
+		t.Errorf("contract address mismatch: have %x, want %x", receipts[1].ContractAddress, want)
+	}
+	for i, receipt := range receipts {
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			t.Errorf("receipt %d: unexpected status %d", i, receipt.Status)
+		}
+		if receipt.TransactionIndex != uint(i) || receipt.BlockHash != block.Hash() {
+			t.Errorf("receipt %d: inclusion info mismatch", i)
+		}
+	}
+	// coinbase获得交易手续费和区块奖励
+	want := new(big.Int).Add(testReward, new(big.Int).SetUint64(usedGas))
+	if balance := statedb.GetBalance(testCoinbase); balance.Cmp(want) != 0 {
+		t.Errorf("coinbase balance mismatch: have %v, want %v", balance, want)
+	}
+	if nonce := statedb.GetNonce(sender); nonce != 2 {
+		t.Errorf("sender nonce mismatch: have %d, want 2", nonce)
+	}
+}
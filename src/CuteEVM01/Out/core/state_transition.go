@@ -0,0 +1,241 @@
+// 实现交易的状态转换: 购买gas、扣除固有gas、执行消息、退还剩余gas并向coinbase支付手续费
+package core
+
+import (
+	"math"
+	"math/big"
+
+	"CuteEVM01"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/params"
+)
+
+/*
+StateTransition 状态转换模型
+
+状态转换是指一笔交易应用到当前世界状态时所做的工作。
+状态转换模型完成所有必需的工作，以计算出一个有效的新状态根。
+
+1) 检查nonce
+2) 预付gas费用
+3) 如果接收者为空，则创建一个新的状态对象
+4) 转账
+4a) 如果是合约创建，尝试运行交易数据，如果有效，使用结果作为新状态对象的代码
+5) 运行脚本部分
+6) 派生新的状态根
+*/
+type StateTransition struct {
+	gp         *GasPool
+	msg        Message
+	gas        uint64
+	gasPrice   *big.Int
+	initialGas uint64
+	value      *big.Int
+	data       []byte
+	state      vm.StateDB
+	evm        *vm.EVM
+}
+
+// IntrinsicGas 计算给定数据的消息的固有gas
+func IntrinsicGas(data []byte, contractCreation, homestead, istanbul, shanghai bool) (uint64, error) {
+	// 设置原始交易的起始gas
+	var gas uint64
+	if contractCreation && homestead {
+		gas = params.TxGasContractCreation
+	} else {
+		gas = params.TxGas
+	}
+	// 按数据的字节数收取gas，零字节和非零字节的价格不同
+	if len(data) > 0 {
+		var nz uint64
+		for _, byt := range data {
+			if byt != 0 {
+				nz++
+			}
+		}
+		// 确保所有数据组合都不会超过uint64
+		nonZeroGas := params.TxDataNonZeroGas
+		if istanbul {
+			nonZeroGas = params.TxDataNonZeroGasEIP2028
+		}
+		if (math.MaxUint64-gas)/nonZeroGas < nz {
+			return 0, ErrGasUintOverflow
+		}
+		gas += nz * nonZeroGas
+
+		z := uint64(len(data)) - nz
+		if (math.MaxUint64-gas)/params.TxDataZeroGas < z {
+			return 0, ErrGasUintOverflow
+		}
+		gas += z * params.TxDataZeroGas
+
+		// EIP-3860: 合约创建时按初始化代码的字数额外收费
+		if contractCreation && shanghai {
+			words := (uint64(len(data)) + 31) / 32
+			if (math.MaxUint64-gas)/params.InitCodeWordGas < words {
+				return 0, ErrGasUintOverflow
+			}
+			gas += words * params.InitCodeWordGas
+		}
+	}
+	return gas, nil
+}
+
+// NewStateTransition 初始化并返回一个新的状态转换对象
+func NewStateTransition(evm *vm.EVM, msg Message, gp *GasPool) *StateTransition {
+	return &StateTransition{
+		gp:       gp,
+		evm:      evm,
+		msg:      msg,
+		gasPrice: msg.GasPrice(),
+		value:    msg.Value(),
+		data:     msg.Data(),
+		state:    evm.StateDB,
+	}
+}
+
+// ApplyMessage 根据给定的消息在当前环境中计算新状态
+//
+// 返回EVM执行的返回数据、使用的gas(包括gas退款)以及执行是否失败。
+// 如果返回了错误，则说明发生了共识问题(例如nonce错误或余额不足)，交易无效，调用者应丢弃对状态的修改。
+func ApplyMessage(evm *vm.EVM, msg Message, gp *GasPool) ([]byte, uint64, bool, error) {
+	return NewStateTransition(evm, msg, gp).TransitionDb()
+}
+
+// to 返回消息的接收者
+func (st *StateTransition) to() common.Address {
+	if st.msg == nil || st.msg.To() == nil /* contract creation */ {
+		return common.Address{}
+	}
+	return *st.msg.To()
+}
+
+// buyGas 从发送者的余额中预付 gas * price，并从区块gas池中扣除gas上限
+func (st *StateTransition) buyGas() error {
+	mgval := new(big.Int).Mul(new(big.Int).SetUint64(st.msg.Gas()), st.gasPrice)
+	if st.state.GetBalance(st.msg.From()).Cmp(mgval) < 0 {
+		return ErrInsufficientFunds
+	}
+	if err := st.gp.SubGas(st.msg.Gas()); err != nil {
+		return err
+	}
+	st.gas += st.msg.Gas()
+
+	st.initialGas = st.msg.Gas()
+	st.state.SubBalance(st.msg.From(), mgval)
+	return nil
+}
+
+// preCheck 检查nonce和base fee，然后购买gas
+func (st *StateTransition) preCheck() error {
+	// 确保这个交易的nonce是正确的
+	if st.msg.CheckNonce() {
+		nonce := st.state.GetNonce(st.msg.From())
+		if nonce < st.msg.Nonce() {
+			return ErrNonceTooHigh
+		} else if nonce > st.msg.Nonce() {
+			return ErrNonceTooLow
+		}
+	}
+	// 伦敦分叉之后，gas价格不能低于区块的base fee
+	if st.evm.ChainConfig().IsLondon(st.evm.BlockNumber) && st.evm.BaseFee != nil {
+		if st.gasPrice.Cmp(st.evm.BaseFee) < 0 {
+			return ErrFeeCapTooLow
+		}
+	}
+	return st.buyGas()
+}
+
+// TransitionDb 将通过应用当前消息来转换状态，并返回EVM执行的结果
+//
+// 返回值依次为: EVM的返回数据、使用的gas(已扣除退款)、执行是否失败，
+// 以及导致交易无效的共识错误。
+func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bool, err error) {
+	if err = st.preCheck(); err != nil {
+		return
+	}
+	msg := st.msg
+	sender := vm.AccountRef(msg.From())
+	rules := st.evm.ChainConfig().Rules(st.evm.BlockNumber)
+	contractCreation := msg.To() == nil
+
+	// 支付固有gas
+	gas, err := IntrinsicGas(st.data, contractCreation, rules.IsHomestead, rules.IsIstanbul, rules.IsShanghai)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if st.gas < gas {
+		return nil, 0, false, ErrIntrinsicGas
+	}
+	st.gas -= gas
+
+	// EIP-3860: 限制初始化代码的大小
+	if rules.IsShanghai && contractCreation && uint64(len(st.data)) > params.MaxInitCodeSize {
+		return nil, 0, false, vm.ErrMaxInitCodeSizeExceeded
+	}
+	// EIP-2929: 发送者、接收者和预编译合约一开始就是热的
+	if rules.IsBerlin {
+		st.state.PrepareAccessList(msg.From(), msg.To(), st.evm.ActivePrecompiles())
+		// EIP-3651: coinbase也是热的
+		if rules.IsShanghai {
+			st.state.AddAddressToAccessList(st.evm.Coinbase)
+		}
+	}
+
+	var (
+		evm = st.evm
+		// vm错误不影响共识，因此不分配给err，
+		// 除非余额不足错误
+		vmerr error
+	)
+	if contractCreation {
+		ret, _, st.gas, vmerr = evm.Create(sender, st.data, st.gas, st.value)
+	} else {
+		// 为下一个交易增加nonce
+		st.state.SetNonce(msg.From(), st.state.GetNonce(sender.Address())+1)
+		ret, st.gas, vmerr = evm.Call(sender, st.to(), st.data, st.gas, st.value)
+	}
+	if vmerr != nil {
+		// 唯一可能的共识错误是，如果没有足够的余额来进行转账。
+		// 第一个余额转账可能永远不会失败。
+		if vmerr == vm.ErrInsufficientBalance {
+			return nil, 0, false, vmerr
+		}
+	}
+	st.refundGas(rules.IsLondon)
+
+	// 向coinbase支付手续费，伦敦分叉之后base fee部分被销毁
+	effectiveTip := st.gasPrice
+	if rules.IsLondon && st.evm.BaseFee != nil {
+		effectiveTip = new(big.Int).Sub(st.gasPrice, st.evm.BaseFee)
+	}
+	st.state.AddBalance(st.evm.Coinbase, new(big.Int).Mul(new(big.Int).SetUint64(st.gasUsed()), effectiveTip))
+
+	return ret, st.gasUsed(), vmerr != nil, err
+}
+
+// refundGas 应用gas退款并将剩余的gas返还给发送者和区块gas池
+func (st *StateTransition) refundGas(london bool) {
+	// 退款上限为已使用gas的一半，EIP-3529之后为五分之一
+	quotient := params.RefundQuotient
+	if london {
+		quotient = params.RefundQuotientEIP3529
+	}
+	refund := st.gasUsed() / quotient
+	if refund > st.state.GetRefund() {
+		refund = st.state.GetRefund()
+	}
+	st.gas += refund
+
+	// 按原价返还剩余的gas
+	remaining := new(big.Int).Mul(new(big.Int).SetUint64(st.gas), st.gasPrice)
+	st.state.AddBalance(st.msg.From(), remaining)
+
+	// 同时将剩余的gas返还给区块gas池，以便下一个交易使用
+	st.gp.AddGas(st.gas)
+}
+
+// gasUsed 返回状态转换使用的gas数量
+func (st *StateTransition) gasUsed() uint64 {
+	return st.initialGas - st.gas
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"CuteEVM01"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/core/types"
+	"CuteEVM01/Out/params"
+)
+
+var (
+	testSender   = common.HexToAddress("0x1000")
+	testCoinbase = common.HexToAddress("0xc0ffee")
+	testContract = common.HexToAddress("0xc0de")
+)
+
+func newTestEVM(statedb *state.StateDB, config *params.ChainConfig, gasPrice, baseFee *big.Int) *vm.EVM {
+	ctx := vm.Context{
+		CanTransfer: CanTransfer,
+		Transfer:    Transfer,
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		Origin:      testSender,
+		Coinbase:    testCoinbase,
+		BlockNumber: new(big.Int),
+		Time:        new(big.Int),
+		Difficulty:  new(big.Int),
+		GasLimit:    10000000,
+		GasPrice:    gasPrice,
+		BaseFee:     baseFee,
+	}
+	return vm.NewEVM(ctx, statedb, config, vm.Config{})
+}
+
+func TestIntrinsicGas(t *testing.T) {
+	data := []byte{0x00, 0x01, 0x00, 0x02}
+	tests := []struct {
+		create, homestead, istanbul, shanghai bool
+		want                                  uint64
+	}{
+		{false, false, false, false, params.TxGas + 2*params.TxDataZeroGas + 2*params.TxDataNonZeroGas},
+		{true, false, false, false, params.TxGas + 2*params.TxDataZeroGas + 2*params.TxDataNonZeroGas},
+		{true, true, false, false, params.TxGasContractCreation + 2*params.TxDataZeroGas + 2*params.TxDataNonZeroGas},
+		{false, true, true, false, params.TxGas + 2*params.TxDataZeroGas + 2*params.TxDataNonZeroGasEIP2028},
+		{true, true, true, true, params.TxGasContractCreation + 2*params.TxDataZeroGas + 2*params.TxDataNonZeroGasEIP2028 + params.InitCodeWordGas},
+	}
+	for i, tt := range tests {
+		gas, err := IntrinsicGas(data, tt.create, tt.homestead, tt.istanbul, tt.shanghai)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if gas != tt.want {
+			t.Errorf("test %d: gas mismatch: have %d, want %d", i, gas, tt.want)
+		}
+	}
+}
+
+func TestApplyMessage(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetBalance(testSender, big.NewInt(1000000000))
+	// 存储槽0原值为1，合约将其清零以获得退款
+	statedb.SetCode(testContract, []byte{byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.SSTORE)})
+	statedb.SetState(testContract, common.Hash{}, common.BytesToHash([]byte{1}))
+	statedb.Finalise(true)
+
+	var (
+		gasPrice = big.NewInt(10)
+		baseFee  = big.NewInt(7)
+		gp       = new(GasPool).AddGas(100000)
+		to       = testContract
+		msg      = types.NewMessage(testSender, &to, 0, new(big.Int), 50000, gasPrice, nil, true)
+	)
+	_, used, failed, err := ApplyMessage(newTestEVM(statedb, params.AllEthashProtocolChanges, gasPrice, baseFee), msg, gp)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if failed {
+		t.Fatal("execution failed")
+	}
+	// 21000固有gas + 2*3 PUSH1 + 2900 SSTORE + 2100 冷存储访问，清零退款4800未超过已用gas的五分之一
+	execGas := params.TxGas + 6 + (params.SstoreCleanGasEIP2200 - params.ColdSloadCostEIP2929) + params.ColdSloadCostEIP2929
+	want := execGas - params.SstoreClearsScheduleRefundEIP3529
+	if used != want {
+		t.Errorf("used gas mismatch: have %d, want %d", used, want)
+	}
+	if nonce := statedb.GetNonce(testSender); nonce != 1 {
+		t.Errorf("nonce mismatch: have %d, want 1", nonce)
+	}
+	if gp.Gas() != 100000-used {
+		t.Errorf("gas pool mismatch: have %d, want %d", gp.Gas(), 100000-used)
+	}
+	wantBalance := new(big.Int).Sub(big.NewInt(1000000000), new(big.Int).Mul(new(big.Int).SetUint64(used), gasPrice))
+	if balance := statedb.GetBalance(testSender); balance.Cmp(wantBalance) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want %v", balance, wantBalance)
+	}
+	// coinbase只获得小费，base fee部分被销毁
+	wantTip := new(big.Int).SetUint64(used * 3)
+	if balance := statedb.GetBalance(testCoinbase); balance.Cmp(wantTip) != 0 {
+		t.Errorf("coinbase balance mismatch: have %v, want %v", balance, wantTip)
+	}
+}
+
+func TestApplyMessageErrors(t *testing.T) {
+	to := testContract
+	tests := []struct {
+		balance int64
+		nonce   uint64
+		gas     uint64
+		price   int64
+		pool    uint64
+		err     error
+	}{
+		{1000000, 1, 21000, 1, 100000, ErrNonceTooHigh},
+		{1000000, 0, 21000, 1, 20000, ErrGasLimitReached},
+		{1000, 0, 21000, 1, 100000, ErrInsufficientFunds},
+		{1000000, 0, 20000, 1, 100000, ErrIntrinsicGas},
+		{1000000, 0, 21000, 0, 100000, ErrFeeCapTooLow},
+	}
+	for i, tt := range tests {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		statedb.SetBalance(testSender, big.NewInt(tt.balance))
+
+		price := big.NewInt(tt.price)
+		msg := types.NewMessage(testSender, &to, tt.nonce, new(big.Int), tt.gas, price, nil, true)
+		_, _, _, err := ApplyMessage(newTestEVM(statedb, params.AllEthashProtocolChanges, price, big.NewInt(1)), msg, new(GasPool).AddGas(tt.pool))
+		if err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestApplyMessageChanges(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetBalance(testSender, big.NewInt(1000000000))
+	statedb.SetCode(testContract, []byte{byte(vm.PUSH1), 0x2a, byte(vm.PUSH1), 0x00, byte(vm.SSTORE)})
+	statedb.Finalise(true)
+	statedb.RecordChanges(true)
+
+	var (
+		gasPrice = big.NewInt(10)
+		to       = testContract
+		txhash   = common.HexToHash("0x01")
+		msg      = types.NewMessage(testSender, &to, 0, new(big.Int), 50000, gasPrice, nil, true)
+	)
+	statedb.Prepare(txhash, common.Hash{}, 0)
+	if _, _, _, err := ApplyMessage(newTestEVM(statedb, params.AllEthashProtocolChanges, gasPrice, big.NewInt(7)), msg, new(GasPool).AddGas(100000)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 与ApplyTransaction一致，每笔交易后Finalise，记录的改动仍可按交易哈希读取
+	statedb.Finalise(true)
+	statedb.IntermediateRoot(true)
+	statedb.Prepare(common.HexToHash("0x02"), common.Hash{}, 1)
+
+	var nonce, storage, coinbase bool
+	for _, change := range statedb.TxChanges(txhash) {
+		switch {
+		case change.Field == state.ChangeNonce && change.Address == testSender:
+			nonce = change.Prev == uint64(0) && change.New == uint64(1)
+		case change.Field == state.ChangeStorage && change.Address == testContract:
+			storage = change.New == common.BigToHash(big.NewInt(0x2a))
+		case change.Field == state.ChangeBalance && change.Address == testCoinbase:
+			coinbase = change.New.(*big.Int).Sign() > 0
+		}
+	}
+	if !nonce || !storage || !coinbase {
+		t.Errorf("missing changes: nonce %v, storage %v, coinbase %v", nonce, storage, coinbase)
+	}
+	if changes := statedb.Changes(); len(changes) != 0 {
+		t.Errorf("changes reported for the next transaction: %v", changes)
+	}
+	statedb.ResetChanges()
+	if changes := statedb.TxChanges(txhash); len(changes) != 0 {
+		t.Errorf("changes reported after reset: %v", changes)
+	}
+}
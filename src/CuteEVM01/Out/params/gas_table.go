@@ -90,4 +90,35 @@ var (
 
 		CreateBySuicide: 25000,
 	}
+
+	// GasTableIstanbul contain the gas re-prices for
+	// the istanbul phase (EIP-1884).
+	GasTableIstanbul = GasTable{
+		ExtcodeSize: 700,
+		ExtcodeCopy: 700,
+		ExtcodeHash: 700,
+		Balance:     700,
+		SLoad:       800,
+		Calls:       700,
+		Suicide:     5000,
+		ExpByte:     50,
+
+		CreateBySuicide: 25000,
+	}
+
+	// GasTableBerlin contain the gas prices for the berlin phase (EIP-2929).
+	// The account and storage access costs are the warm prices, the cold
+	// access surcharge is charged by the interpreter based on the access list.
+	GasTableBerlin = GasTable{
+		ExtcodeSize: WarmStorageReadCostEIP2929,
+		ExtcodeCopy: WarmStorageReadCostEIP2929,
+		ExtcodeHash: WarmStorageReadCostEIP2929,
+		Balance:     WarmStorageReadCostEIP2929,
+		SLoad:       WarmStorageReadCostEIP2929,
+		Calls:       WarmStorageReadCostEIP2929,
+		Suicide:     5000,
+		ExpByte:     50,
+
+		CreateBySuicide: 25000,
+	}
 )
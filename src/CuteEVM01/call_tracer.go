@@ -0,0 +1,146 @@
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/hexutil"
+)
+
+// CallFrame 是调用树中的一个节点，对应一次消息调用(包括合约创建)，子调用按执行顺序嵌套在 Calls 中
+type CallFrame struct {
+	Type         string         `json:"type"`
+	From         common.Address `json:"from"`
+	To           common.Address `json:"to"`
+	Value        *hexutil.Big   `json:"value,omitempty"`
+	Gas          hexutil.Uint64 `json:"gas"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Input        hexutil.Bytes  `json:"input"`
+	Output       hexutil.Bytes  `json:"output,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	RevertReason string         `json:"revertReason,omitempty"`
+	Calls        []CallFrame    `json:"calls,omitempty"`
+}
+
+// processOutput 记录调用帧的返回数据和错误，回滚时解码其中的原因
+func (f *CallFrame) processOutput(output []byte, err error) {
+	output = common.CopyBytes(output)
+	if err == nil {
+		f.Output = output
+		return
+	}
+	f.Error = err.Error()
+	if f.Type == CREATE.String() || f.Type == CREATE2.String() {
+		f.To = common.Address{}
+	}
+	if !IsRevert(err) {
+		return
+	}
+	// 顶层调用返回的 RevertError 可能已经按ABI解码了自定义错误
+	revert, ok := err.(*RevertError)
+	if !ok {
+		revert = NewRevertError(output, nil)
+	}
+	f.Error = errExecutionReverted.Error()
+	f.RevertReason = revert.Reason()
+	if len(output) > 0 {
+		f.Output = output
+	}
+}
+
+// CallTracer 是一个实现了 Tracer 的调用树记录器。
+//
+// 与逐条记录指令的 StructLogger 不同，CallTracer 只关心调用帧:
+// 每次 CALL、CALLCODE、DELEGATECALL、STATICCALL、CREATE 和 CREATE2 都会成为父调用下的一个子节点，
+// 执行结束后可以通过 Result 或 GetResult 得到整棵调用树
+type CallTracer struct {
+	callstack []CallFrame
+}
+
+// NewCallTracer 返回一个新的调用树记录器
+func NewCallTracer() *CallTracer {
+	return &CallTracer{callstack: make([]CallFrame, 1)}
+}
+
+// CaptureStart 记录顶层调用
+func (t *CallTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	typ := CALL
+	if create {
+		typ = CREATE
+	}
+	t.callstack[0] = CallFrame{
+		Type:  typ.String(),
+		From:  from,
+		To:    to,
+		Input: common.CopyBytes(input),
+		Gas:   hexutil.Uint64(gas),
+	}
+	if value != nil {
+		t.callstack[0].Value = (*hexutil.Big)(new(big.Int).Set(value))
+	}
+	return nil
+}
+
+// CaptureState 实现 Tracer 接口，调用树不关心单条指令
+func (t *CallTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureFault 实现 Tracer 接口，错误会在调用帧退出时记录
+func (t *CallTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd 记录顶层调用的结果
+func (t *CallTracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) error {
+	t.callstack[0].GasUsed = hexutil.Uint64(gasUsed)
+	t.callstack[0].processOutput(output, err)
+	return nil
+}
+
+// CaptureEnter 为新的调用帧压入一个节点
+func (t *CallTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	frame := CallFrame{
+		Type:  typ.String(),
+		From:  from,
+		To:    to,
+		Input: common.CopyBytes(input),
+		Gas:   hexutil.Uint64(gas),
+	}
+	if value != nil {
+		frame.Value = (*hexutil.Big)(new(big.Int).Set(value))
+	}
+	t.callstack = append(t.callstack, frame)
+	return nil
+}
+
+// CaptureExit 弹出当前调用帧，并把它挂到父调用帧的子调用列表中
+func (t *CallTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	size := len(t.callstack)
+	if size <= 1 {
+		return nil
+	}
+	frame := t.callstack[size-1]
+	t.callstack = t.callstack[:size-1]
+
+	frame.GasUsed = hexutil.Uint64(gasUsed)
+	frame.processOutput(output, err)
+	t.callstack[size-2].Calls = append(t.callstack[size-2].Calls, frame)
+	return nil
+}
+
+// Result 返回记录的调用树的根节点
+func (t *CallTracer) Result() *CallFrame {
+	return &t.callstack[0]
+}
+
+// GetResult 以JSON格式返回记录的调用树
+func (t *CallTracer) GetResult() (json.RawMessage, error) {
+	if len(t.callstack) != 1 {
+		return nil, errors.New("incorrect number of top-level calls")
+	}
+	return json.Marshal(t.callstack[0])
+}
@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/params"
+)
+
+func TestCallTracer(t *testing.T) {
+	var (
+		caller   = common.BytesToAddress([]byte("caller"))
+		callee   = common.BytesToAddress([]byte("callee"))
+		identity = common.BytesToAddress([]byte{4})
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetCode(callee, revertCode("boom"))
+	// staticcall(gas, 0x04, 0, 0, 0, 0)
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 4, byte(GAS), byte(STATICCALL), byte(POP)}
+	// call(50000, callee, 0, 0, 0, 0, 0)
+	code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH32))
+	code = append(code, common.LeftPadBytes(callee.Bytes(), 32)...)
+	code = append(code, byte(PUSH2), 0xc3, 0x50, byte(CALL), byte(POP), byte(STOP))
+	statedb.SetCode(caller, code)
+
+	tracer := NewCallTracer()
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: tracer})
+	if _, _, err := vmenv.Call(AccountRef(common.Address{}), caller, []byte{0xca, 0xfe}, 1000000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	root := tracer.Result()
+	if root.Type != "CALL" || root.To != caller || root.Gas != 1000000 || root.Error != "" {
+		t.Errorf("root frame mismatch: %+v", root)
+	}
+	if len(root.Calls) != 2 {
+		t.Fatalf("child count mismatch: have %d, want 2", len(root.Calls))
+	}
+	if call := root.Calls[0]; call.Type != "STATICCALL" || call.To != identity || uint64(call.GasUsed) != params.IdentityBaseGas {
+		t.Errorf("staticcall frame mismatch: %+v", call)
+	}
+	call := root.Calls[1]
+	if call.Type != "CALL" || call.From != caller || call.To != callee || call.Gas != 50000 {
+		t.Errorf("call frame mismatch: %+v", call)
+	}
+	if call.Error != errExecutionReverted.Error() || call.RevertReason != "boom" || len(call.Output) != 100 {
+		t.Errorf("revert mismatch: error %q, reason %q, output %x", call.Error, call.RevertReason, call.Output)
+	}
+	// JSON 输出中子调用应嵌套在 calls 中
+	blob, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to encode result: %v", err)
+	}
+	var decoded struct {
+		Type  string `json:"type"`
+		Input string `json:"input"`
+		Calls []struct {
+			Type         string `json:"type"`
+			RevertReason string `json:"revertReason"`
+		} `json:"calls"`
+	}
+	if err := json.Unmarshal(blob, &decoded); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if decoded.Type != "CALL" || decoded.Input != "0xcafe" || len(decoded.Calls) != 2 || decoded.Calls[1].RevertReason != "boom" {
+		t.Errorf("unexpected JSON result: %s", blob)
+	}
+}
@@ -0,0 +1,335 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/crypto"
+)
+
+// SourceRange 是Solidity源码映射中一条指令对应的源码范围
+type SourceRange struct {
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	File   int    `json:"file"`           // 源文件编号，-1表示由编译器生成的代码
+	Jump   string `json:"jump,omitempty"` // "i" 跳入函数，"o" 从函数返回，"-" 普通跳转
+}
+
+// ParseSourceMap 解析solc输出的压缩格式源码映射("s:l:f:j;s:l:f:j;...")，
+// 省略的字段沿用前一条指令的值。结果按指令序号(而不是PC)索引
+func ParseSourceMap(srcmap string) ([]SourceRange, error) {
+	var (
+		ranges []SourceRange
+		last   = SourceRange{File: -1, Jump: "-"}
+	)
+	if srcmap == "" {
+		return nil, nil
+	}
+	for i, entry := range strings.Split(srcmap, ";") {
+		fields := strings.Split(entry, ":")
+		for j, field := range fields {
+			if field == "" {
+				continue
+			}
+			switch j {
+			case 0, 1, 2:
+				n, err := strconv.Atoi(field)
+				if err != nil {
+					return nil, fmt.Errorf("invalid source map entry %d: %q", i, entry)
+				}
+				switch j {
+				case 0:
+					last.Offset = n
+				case 1:
+					last.Length = n
+				case 2:
+					last.File = n
+				}
+			case 3:
+				if field != "i" && field != "o" && field != "-" {
+					return nil, fmt.Errorf("invalid jump type in source map entry %d: %q", i, entry)
+				}
+				last.Jump = field
+			}
+		}
+		ranges = append(ranges, last)
+	}
+	return ranges, nil
+}
+
+// BranchCoverage 是一条JUMPI指令两个分支的执行次数
+type BranchCoverage struct {
+	Pc       uint64 `json:"pc"`
+	Taken    uint64 `json:"taken"`
+	NotTaken uint64 `json:"notTaken"`
+}
+
+// CodeCoverage 是一段代码(由代码哈希确定)的覆盖情况
+type CodeCoverage struct {
+	CodeHash common.Hash
+	Code     []byte
+
+	hits     map[uint64]uint64          // 每个PC的执行次数
+	branches map[uint64]*BranchCoverage // 每条JUMPI的分支执行次数
+	srcmap   []SourceRange              // 按指令序号索引的源码映射
+}
+
+// Instructions 返回代码中所有指令的PC。
+// 指令边界由 codeBitmap 确定，PUSH的数据不算作指令
+func (c *CodeCoverage) Instructions() []uint64 {
+	var (
+		bits = codeBitmap(c.Code)
+		pcs  []uint64
+	)
+	for pc := uint64(0); pc < uint64(len(c.Code)); pc++ {
+		if bits.codeSegment(pc) {
+			pcs = append(pcs, pc)
+		}
+	}
+	return pcs
+}
+
+// Hits 返回给定PC的执行次数
+func (c *CodeCoverage) Hits(pc uint64) uint64 {
+	return c.hits[pc]
+}
+
+// Branch 返回给定PC上JUMPI的分支执行次数，没有执行过时返回nil
+func (c *CodeCoverage) Branch(pc uint64) *BranchCoverage {
+	return c.branches[pc]
+}
+
+// Source 返回给定PC对应的源码范围，没有设置源码映射或PC不是指令时返回false
+func (c *CodeCoverage) Source(pc uint64) (SourceRange, bool) {
+	for i, ipc := range c.Instructions() {
+		if ipc == pc {
+			if i < len(c.srcmap) {
+				return c.srcmap[i], true
+			}
+			break
+		}
+	}
+	return SourceRange{}, false
+}
+
+// PcCoverage 是覆盖率报告中的一条指令
+type PcCoverage struct {
+	Pc     uint64       `json:"pc"`
+	Op     string       `json:"op"`
+	Hits   uint64       `json:"hits"`
+	Source *SourceRange `json:"source,omitempty"`
+}
+
+// CoverageReport 是一段代码的覆盖率报告
+type CoverageReport struct {
+	CodeHash        common.Hash      `json:"codeHash"`
+	Instructions    int              `json:"instructions"`
+	Covered         int              `json:"covered"`
+	Coverage        float64          `json:"coverage"` // 指令覆盖率百分比
+	Branches        int              `json:"branches"` // 分支总数，每条JUMPI有两个分支
+	BranchesCovered int              `json:"branchesCovered"`
+	Pcs             []PcCoverage     `json:"pcs"`
+	BranchHits      []BranchCoverage `json:"branchHits"`
+}
+
+// Report 生成该代码的覆盖率报告
+func (c *CodeCoverage) Report() *CoverageReport {
+	report := &CoverageReport{CodeHash: c.CodeHash}
+	for i, pc := range c.Instructions() {
+		op := OpCode(c.Code[pc])
+		entry := PcCoverage{Pc: pc, Op: op.String(), Hits: c.hits[pc]}
+		if i < len(c.srcmap) {
+			src := c.srcmap[i]
+			entry.Source = &src
+		}
+		report.Instructions++
+		if entry.Hits > 0 {
+			report.Covered++
+		}
+		if op == JUMPI {
+			branch := BranchCoverage{Pc: pc}
+			if b := c.branches[pc]; b != nil {
+				branch = *b
+			}
+			report.Branches += 2
+			if branch.Taken > 0 {
+				report.BranchesCovered++
+			}
+			if branch.NotTaken > 0 {
+				report.BranchesCovered++
+			}
+			report.BranchHits = append(report.BranchHits, branch)
+		}
+		report.Pcs = append(report.Pcs, entry)
+	}
+	if report.Instructions > 0 {
+		report.Coverage = 100 * float64(report.Covered) / float64(report.Instructions)
+	}
+	return report
+}
+
+// CoverageTracer 是一个实现了 Tracer 的代码覆盖率记录器。
+//
+// 它按代码哈希记录每段被执行代码中执行过的PC，以及每条JUMPI跳转与不跳转的次数。
+// 通过 SetSourceMap 设置Solidity源码映射后，报告中的每条指令都会带有对应的源码范围
+type CoverageTracer struct {
+	codes   map[common.Hash]*CodeCoverage
+	srcmaps map[common.Hash][]SourceRange
+	frames  []*CodeCoverage // 每个调用帧正在执行的代码，尚未执行指令时为nil
+}
+
+// NewCoverageTracer 返回一个新的覆盖率记录器
+func NewCoverageTracer() *CoverageTracer {
+	return &CoverageTracer{
+		codes:   make(map[common.Hash]*CodeCoverage),
+		srcmaps: make(map[common.Hash][]SourceRange),
+	}
+}
+
+// SetSourceMap 为给定代码哈希的代码设置solc输出的压缩格式源码映射
+func (t *CoverageTracer) SetSourceMap(codeHash common.Hash, srcmap string) error {
+	ranges, err := ParseSourceMap(srcmap)
+	if err != nil {
+		return err
+	}
+	t.srcmaps[codeHash] = ranges
+	if c := t.codes[codeHash]; c != nil {
+		c.srcmap = ranges
+	}
+	return nil
+}
+
+// CaptureStart 为顶层调用创建调用帧
+func (t *CoverageTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.frames = append(t.frames[:0], nil)
+	return nil
+}
+
+// CaptureState 记录执行的PC和JUMPI的分支
+func (t *CoverageTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if err != nil || len(t.frames) == 0 || pc >= uint64(len(contract.Code)) {
+		return nil
+	}
+	c := t.frames[len(t.frames)-1]
+	if c == nil {
+		c = t.code(contract)
+		t.frames[len(t.frames)-1] = c
+	}
+	c.hits[pc]++
+
+	if op == JUMPI && stack.len() >= 2 {
+		branch := c.branches[pc]
+		if branch == nil {
+			branch = &BranchCoverage{Pc: pc}
+			c.branches[pc] = branch
+		}
+		if stack.Back(1).Sign() != 0 {
+			branch.Taken++
+		} else {
+			branch.NotTaken++
+		}
+	}
+	return nil
+}
+
+// code 返回合约代码的覆盖记录，第一次执行时创建
+func (t *CoverageTracer) code(contract *Contract) *CodeCoverage {
+	hash := contract.CodeHash
+	if hash == (common.Hash{}) {
+		hash = crypto.Keccak256Hash(contract.Code)
+	}
+	c := t.codes[hash]
+	if c == nil {
+		c = &CodeCoverage{
+			CodeHash: hash,
+			Code:     common.CopyBytes(contract.Code),
+			hits:     make(map[uint64]uint64),
+			branches: make(map[uint64]*BranchCoverage),
+			srcmap:   t.srcmaps[hash],
+		}
+		t.codes[hash] = c
+	}
+	return c
+}
+
+// CaptureFault 实现 Tracer 接口
+func (t *CoverageTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd 实现 Tracer 接口
+func (t *CoverageTracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) error {
+	return nil
+}
+
+// CaptureEnter 为子调用创建调用帧
+func (t *CoverageTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	t.frames = append(t.frames, nil)
+	return nil
+}
+
+// CaptureExit 弹出当前调用帧
+func (t *CoverageTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	if len(t.frames) > 1 {
+		t.frames = t.frames[:len(t.frames)-1]
+	}
+	return nil
+}
+
+// Coverage 返回给定代码哈希的覆盖记录，代码没有被执行过时返回nil
+func (t *CoverageTracer) Coverage(codeHash common.Hash) *CodeCoverage {
+	return t.codes[codeHash]
+}
+
+// Reports 返回所有被执行代码的覆盖率报告，按代码哈希排序。
+// 可以多次执行(例如整个测试集)后再生成报告，结果是所有执行的累计
+func (t *CoverageTracer) Reports() []*CoverageReport {
+	reports := make([]*CoverageReport, 0, len(t.codes))
+	for _, c := range t.codes {
+		reports = append(reports, c.Report())
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].CodeHash.Big().Cmp(reports[j].CodeHash.Big()) < 0
+	})
+	return reports
+}
+
+// WriteJSON 将所有覆盖率报告以JSON格式写入给定的writer
+func (t *CoverageTracer) WriteJSON(writer io.Writer) error {
+	enc := json.NewEncoder(writer)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t.Reports())
+}
+
+// WriteLCOV 将所有覆盖率报告以lcov的tracefile格式写入给定的writer。
+// 每段代码是一条记录，源文件名为代码哈希，行号为指令的PC加1
+func (t *CoverageTracer) WriteLCOV(writer io.Writer) {
+	for _, report := range t.Reports() {
+		fmt.Fprintln(writer, "TN:")
+		fmt.Fprintf(writer, "SF:%s\n", report.CodeHash.Hex())
+		for _, pc := range report.Pcs {
+			fmt.Fprintf(writer, "DA:%d,%d\n", pc.Pc+1, pc.Hits)
+		}
+		for _, branch := range report.BranchHits {
+			// 没有执行过的JUMPI两个分支都记为 "-"
+			taken, notTaken := "-", "-"
+			if branch.Taken > 0 || branch.NotTaken > 0 {
+				taken, notTaken = strconv.FormatUint(branch.Taken, 10), strconv.FormatUint(branch.NotTaken, 10)
+			}
+			fmt.Fprintf(writer, "BRDA:%d,0,0,%s\n", branch.Pc+1, taken)
+			fmt.Fprintf(writer, "BRDA:%d,0,1,%s\n", branch.Pc+1, notTaken)
+		}
+		fmt.Fprintf(writer, "BRF:%d\n", report.Branches)
+		fmt.Fprintf(writer, "BRH:%d\n", report.BranchesCovered)
+		fmt.Fprintf(writer, "LF:%d\n", report.Instructions)
+		fmt.Fprintf(writer, "LH:%d\n", report.Covered)
+		fmt.Fprintln(writer, "end_of_record")
+	}
+}
@@ -0,0 +1,102 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/crypto"
+	"CuteEVM01/Out/params"
+)
+
+func TestParseSourceMap(t *testing.T) {
+	ranges, err := ParseSourceMap("1:2:0:-;:9;3::1:i;;-1:4:-1:o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SourceRange{
+		{1, 2, 0, "-"},
+		{1, 9, 0, "-"},
+		{3, 9, 1, "i"},
+		{3, 9, 1, "i"},
+		{-1, 4, -1, "o"},
+	}
+	if len(ranges) != len(want) {
+		t.Fatalf("length mismatch: have %d, want %d", len(ranges), len(want))
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Errorf("entry %d mismatch: have %+v, want %+v", i, ranges[i], want[i])
+		}
+	}
+	if _, err := ParseSourceMap("1:2:x"); err == nil {
+		t.Error("expected error for invalid file index")
+	}
+}
+
+func TestCoverageTracer(t *testing.T) {
+	// jumpi(7, 1); push1 0 (不可达); jumpdest; stop
+	code := []byte{byte(PUSH1), 1, byte(PUSH1), 7, byte(JUMPI), byte(PUSH1), 0, byte(JUMPDEST), byte(STOP)}
+	var (
+		address  = common.BytesToAddress([]byte("contract"))
+		codeHash = crypto.Keccak256Hash(code)
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetCode(address, code)
+
+	tracer := NewCoverageTracer()
+	if err := tracer.SetSourceMap(codeHash, "0:10:0:-;;;12:3:0:i;;"); err != nil {
+		t.Fatal(err)
+	}
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: tracer})
+	if _, _, err := vmenv.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	c := tracer.Coverage(codeHash)
+	if c == nil {
+		t.Fatal("missing coverage for executed code")
+	}
+	// PUSH的数据不是指令
+	if have, want := c.Instructions(), []uint64{0, 2, 4, 5, 7, 8}; len(have) != len(want) {
+		t.Fatalf("instruction mismatch: have %v, want %v", have, want)
+	}
+	if c.Hits(5) != 0 || c.Hits(7) != 1 {
+		t.Errorf("hit mismatch: pc5 %d, pc7 %d", c.Hits(5), c.Hits(7))
+	}
+	if b := c.Branch(4); b == nil || b.Taken != 1 || b.NotTaken != 0 {
+		t.Errorf("branch mismatch: %+v", b)
+	}
+	if src, ok := c.Source(7); !ok || src != (SourceRange{12, 3, 0, "i"}) {
+		t.Errorf("source mismatch: %+v, %v", src, ok)
+	}
+
+	reports := tracer.Reports()
+	if len(reports) != 1 {
+		t.Fatalf("report count mismatch: have %d, want 1", len(reports))
+	}
+	report := reports[0]
+	if report.Instructions != 6 || report.Covered != 5 || report.Branches != 2 || report.BranchesCovered != 1 {
+		t.Errorf("report mismatch: %+v", report)
+	}
+	if report.Coverage < 83.3 || report.Coverage > 83.4 {
+		t.Errorf("coverage mismatch: have %v, want 83.33", report.Coverage)
+	}
+
+	var lcov bytes.Buffer
+	tracer.WriteLCOV(&lcov)
+	for _, line := range []string{"SF:" + codeHash.Hex(), "DA:6,0", "DA:8,1", "BRDA:5,0,0,1", "BRDA:5,0,1,0", "LF:6", "LH:5", "end_of_record"} {
+		if !strings.Contains(lcov.String(), line+"\n") {
+			t.Errorf("lcov output missing %q:\n%s", line, lcov.String())
+		}
+	}
+}
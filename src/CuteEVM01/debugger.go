@@ -0,0 +1,290 @@
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"CuteEVM01/Out/common"
+)
+
+// BreakpointKind 是断点的类型
+type BreakpointKind int
+
+const (
+	BreakPC      BreakpointKind = iota // 执行到给定PC时暂停，Address 非零时只匹配该地址的代码
+	BreakOp                            // 执行给定操作码时暂停
+	BreakAddress                       // 进入给定地址的代码时暂停
+	BreakStorage                       // SLOAD或SSTORE访问给定存储槽时暂停，Address 非零时只匹配该合约
+)
+
+// Breakpoint 是调试器中的一个断点
+type Breakpoint struct {
+	ID      int
+	Kind    BreakpointKind
+	Pc      uint64
+	Op      OpCode
+	Address common.Address
+	Slot    common.Hash
+}
+
+func (bp Breakpoint) String() string {
+	switch bp.Kind {
+	case BreakPC:
+		if bp.Address != (common.Address{}) {
+			return fmt.Sprintf("#%d pc %d at %x", bp.ID, bp.Pc, bp.Address)
+		}
+		return fmt.Sprintf("#%d pc %d", bp.ID, bp.Pc)
+	case BreakOp:
+		return fmt.Sprintf("#%d op %v", bp.ID, bp.Op)
+	case BreakAddress:
+		return fmt.Sprintf("#%d address %x", bp.ID, bp.Address)
+	case BreakStorage:
+		if bp.Address != (common.Address{}) {
+			return fmt.Sprintf("#%d slot %x at %x", bp.ID, bp.Slot, bp.Address)
+		}
+		return fmt.Sprintf("#%d slot %x", bp.ID, bp.Slot)
+	}
+	return fmt.Sprintf("#%d unknown", bp.ID)
+}
+
+// DebugState 是调试器暂停时，即将执行的指令及其所在调用帧的状态
+type DebugState struct {
+	Pc          uint64
+	Op          OpCode
+	Gas         uint64
+	Cost        uint64
+	Depth       int
+	Address     common.Address // 当前合约(存储所属)的地址
+	CodeAddress common.Address // 正在执行的代码所在的地址
+	Stack       []*big.Int
+	Memory      []byte
+	Breakpoint  *Breakpoint // 触发暂停的断点，单步执行时为nil
+
+	statedb StateDB
+}
+
+// Storage 返回当前合约中给定存储槽的值，只能在调试器暂停时调用
+func (s *DebugState) Storage(slot common.Hash) common.Hash {
+	return s.statedb.GetState(s.Address, slot)
+}
+
+// debugCommand 是暂停后恢复执行的方式
+type debugCommand int
+
+const (
+	debugContinue debugCommand = iota
+	debugStep
+	debugStepOver
+	debugAbort
+)
+
+// Debugger 是一个实现了 Tracer 的交互式调试器。
+//
+// 执行在 Start 启动的goroutine中进行，遇到断点或单步执行时 CaptureState 会阻塞，
+// 直到控制方通过 Continue、Step、StepOver 或 Abort 恢复执行。典型用法:
+//
+//	dbg := vm.NewDebugger(true)
+//	dbg.Start(func() { runtime.Call(address, input, cfg) })
+//	for state, ok := dbg.Wait(); ok; state, ok = dbg.Wait() {
+//		// 查看 state 后恢复执行
+//		dbg.Step()
+//	}
+type Debugger struct {
+	mu          sync.Mutex
+	breakpoints []*Breakpoint
+	nextID      int
+
+	// 以下字段只在执行的goroutine中访问
+	stepping     bool // 在下一条指令暂停
+	stepOverAt   int  // 大于0时，在调用深度不超过该值的下一条指令暂停
+	enteredFrame bool // 下一条指令是否是一个新调用帧的第一条指令
+	aborted      bool
+
+	pauses   chan *DebugState
+	resume   chan debugCommand
+	finished chan struct{}
+}
+
+// NewDebugger 返回一个新的调试器，stopOnEntry 为true时在第一条指令暂停
+func NewDebugger(stopOnEntry bool) *Debugger {
+	return &Debugger{
+		stepping: stopOnEntry,
+		nextID:   1,
+		pauses:   make(chan *DebugState),
+		resume:   make(chan debugCommand),
+		finished: make(chan struct{}),
+	}
+}
+
+// AddBreakpoint 添加一个断点并返回它的编号，bp.ID 会被忽略
+func (d *Debugger) AddBreakpoint(bp Breakpoint) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bp.ID = d.nextID
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, &bp)
+	return bp.ID
+}
+
+// RemoveBreakpoint 删除给定编号的断点，断点不存在时返回false
+func (d *Debugger) RemoveBreakpoint(id int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, bp := range d.breakpoints {
+		if bp.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Breakpoints 返回所有断点
+func (d *Debugger) Breakpoints() []Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bps := make([]Breakpoint, len(d.breakpoints))
+	for i, bp := range d.breakpoints {
+		bps[i] = *bp
+	}
+	return bps
+}
+
+// Start 在新的goroutine中运行给定的执行函数，函数中的EVM必须以该调试器作为 Tracer
+func (d *Debugger) Start(exec func()) {
+	go func() {
+		defer close(d.finished)
+		exec()
+	}()
+}
+
+// Wait 等待执行暂停并返回暂停时的状态，执行结束时返回false
+func (d *Debugger) Wait() (*DebugState, bool) {
+	select {
+	case state := <-d.pauses:
+		return state, true
+	case <-d.finished:
+		return nil, false
+	}
+}
+
+// Continue 恢复执行，直到遇到下一个断点
+func (d *Debugger) Continue() { d.resume <- debugContinue }
+
+// Step 执行一条指令后暂停，调用指令会在子调用的第一条指令暂停
+func (d *Debugger) Step() { d.resume <- debugStep }
+
+// StepOver 执行一条指令后暂停，调用指令会等子调用全部执行完后才暂停(除非其中遇到断点)
+func (d *Debugger) StepOver() { d.resume <- debugStepOver }
+
+// Abort 中止执行，之后不会再暂停。被中止的执行以 ErrExecutionAborted 结束，状态改动会被回滚
+func (d *Debugger) Abort() { d.resume <- debugAbort }
+
+// CaptureStart 实现 Tracer 接口
+func (d *Debugger) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	d.enteredFrame = true
+	return nil
+}
+
+// CaptureState 在需要暂停时阻塞，直到控制方恢复执行
+func (d *Debugger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if err != nil || d.aborted {
+		return nil
+	}
+	codeAddress := contract.Address()
+	if contract.CodeAddr != nil {
+		codeAddress = *contract.CodeAddr
+	}
+	entered := d.enteredFrame
+	d.enteredFrame = false
+
+	bp := d.matchBreakpoint(pc, op, stack, contract.Address(), codeAddress, entered)
+	if bp == nil && !d.stepping && (d.stepOverAt == 0 || depth > d.stepOverAt) {
+		return nil
+	}
+	state := &DebugState{
+		Pc:          pc,
+		Op:          op,
+		Gas:         gas,
+		Cost:        cost,
+		Depth:       depth,
+		Address:     contract.Address(),
+		CodeAddress: codeAddress,
+		Stack:       make([]*big.Int, len(stack.Data())),
+		Memory:      common.CopyBytes(memory.Data()),
+		Breakpoint:  bp,
+		statedb:     env.StateDB,
+	}
+	for i, item := range stack.Data() {
+		state.Stack[i] = new(big.Int).Set(item)
+	}
+	d.pauses <- state
+
+	d.stepping, d.stepOverAt = false, 0
+	switch <-d.resume {
+	case debugStep:
+		d.stepping = true
+	case debugStepOver:
+		d.stepOverAt = depth
+	case debugAbort:
+		d.aborted = true
+		env.Cancel()
+	}
+	return nil
+}
+
+// matchBreakpoint 返回第一个与即将执行的指令匹配的断点
+func (d *Debugger) matchBreakpoint(pc uint64, op OpCode, stack *Stack, address, codeAddress common.Address, entered bool) *Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, bp := range d.breakpoints {
+		switch bp.Kind {
+		case BreakPC:
+			if bp.Pc == pc && (bp.Address == (common.Address{}) || bp.Address == codeAddress) {
+				return bp
+			}
+		case BreakOp:
+			if bp.Op == op {
+				return bp
+			}
+		case BreakAddress:
+			if entered && bp.Address == codeAddress {
+				return bp
+			}
+		case BreakStorage:
+			if (op == SLOAD || op == SSTORE) && stack.len() >= 1 && common.BigToHash(stack.Back(0)) == bp.Slot &&
+				(bp.Address == (common.Address{}) || bp.Address == address) {
+				return bp
+			}
+		}
+	}
+	return nil
+}
+
+// CaptureFault 实现 Tracer 接口
+func (d *Debugger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd 实现 Tracer 接口
+func (d *Debugger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	return nil
+}
+
+// CaptureEnter 记录新的调用帧，以便地址断点在其第一条指令处暂停
+func (d *Debugger) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	d.enteredFrame = true
+	return nil
+}
+
+// CaptureExit 实现 Tracer 接口
+func (d *Debugger) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	d.enteredFrame = false
+	return nil
+}
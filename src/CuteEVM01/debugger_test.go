@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/params"
+)
+
+// startDebugger 部署测试合约，并在调试器中从 caller 开始执行。执行结束后(Wait 返回false) callErr 指向调用返回的错误
+func startDebugger(t *testing.T, dbg *Debugger) (caller, callee common.Address, callErr *error) {
+	caller = common.BytesToAddress([]byte("caller"))
+	callee = common.BytesToAddress([]byte("callee"))
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	// sstore(5, 2)
+	statedb.SetCode(callee, []byte{byte(PUSH1), 2, byte(PUSH1), 5, byte(SSTORE), byte(STOP)})
+	// sstore(0, 1); call(gas, callee, 0, 0, 0, 0, 0); stop
+	code := []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE)}
+	code = append(code, byte(PUSH1), 0, byte(DUP1), byte(DUP1), byte(DUP1), byte(DUP1), byte(PUSH32))
+	code = append(code, common.LeftPadBytes(callee.Bytes(), 32)...)
+	code = append(code, byte(GAS), byte(CALL), byte(POP), byte(STOP))
+	statedb.SetCode(caller, code)
+
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: dbg})
+	callErr = new(error)
+	dbg.Start(func() {
+		_, _, *callErr = vmenv.Call(AccountRef(common.Address{}), caller, nil, 1000000, new(big.Int))
+	})
+	return caller, callee, callErr
+}
+
+// expectPause 等待下一次暂停并检查暂停的位置
+func expectPause(t *testing.T, dbg *Debugger, address common.Address, pc uint64, op OpCode) *DebugState {
+	t.Helper()
+	state, ok := dbg.Wait()
+	if !ok {
+		t.Fatalf("execution finished, want pause at %x pc %d", address, pc)
+	}
+	if state.CodeAddress != address || state.Pc != pc || state.Op != op {
+		t.Fatalf("pause mismatch: have %x pc %d %v, want %x pc %d %v", state.CodeAddress, state.Pc, state.Op, address, pc, op)
+	}
+	return state
+}
+
+func TestDebuggerStep(t *testing.T) {
+	dbg := NewDebugger(true)
+	caller, callee, callErr := startDebugger(t, dbg)
+
+	expectPause(t, dbg, caller, 0, PUSH1)
+	dbg.Step()
+	state := expectPause(t, dbg, caller, 2, PUSH1)
+	if len(state.Stack) != 1 || state.Stack[0].Uint64() != 1 {
+		t.Errorf("stack mismatch: %v", state.Stack)
+	}
+	// 在子调用的存储槽上设置断点，单步执行时暂停之间的指令不受影响
+	id := dbg.AddBreakpoint(Breakpoint{Kind: BreakStorage, Slot: common.BigToHash(big.NewInt(5))})
+	dbg.Continue()
+	state = expectPause(t, dbg, callee, 4, SSTORE)
+	if state.Depth != 2 || state.Breakpoint == nil || state.Breakpoint.ID != id {
+		t.Errorf("breakpoint pause mismatch: depth %d, breakpoint %v", state.Depth, state.Breakpoint)
+	}
+	if value := state.Storage(common.BigToHash(big.NewInt(5))); value != (common.Hash{}) {
+		t.Errorf("storage written before SSTORE executed: %x", value)
+	}
+	if !dbg.RemoveBreakpoint(id) || len(dbg.Breakpoints()) != 0 {
+		t.Errorf("failed to remove breakpoint")
+	}
+	dbg.Step()
+	state = expectPause(t, dbg, callee, 5, STOP)
+	if value := state.Storage(common.BigToHash(big.NewInt(5))); value != common.BigToHash(big.NewInt(2)) {
+		t.Errorf("storage mismatch after SSTORE: %x", value)
+	}
+	// 子调用返回后回到调用者
+	dbg.Step()
+	expectPause(t, dbg, caller, 46, POP)
+	dbg.Continue()
+	if _, ok := dbg.Wait(); ok {
+		t.Error("expected execution to finish")
+	}
+	if *callErr != nil {
+		t.Errorf("call failed: %v", *callErr)
+	}
+}
+
+func TestDebuggerStepOver(t *testing.T) {
+	dbg := NewDebugger(false)
+	dbg.AddBreakpoint(Breakpoint{Kind: BreakOp, Op: CALL})
+	caller, _, callErr := startDebugger(t, dbg)
+
+	state := expectPause(t, dbg, caller, 45, CALL)
+	if len(state.Stack) != 7 {
+		t.Errorf("stack size mismatch: have %d, want 7", len(state.Stack))
+	}
+	dbg.StepOver()
+	state = expectPause(t, dbg, caller, 46, POP)
+	if state.Depth != 1 || state.Stack[len(state.Stack)-1].Uint64() != 1 {
+		t.Errorf("step over mismatch: depth %d, stack %v", state.Depth, state.Stack)
+	}
+	dbg.Continue()
+	if _, ok := dbg.Wait(); ok {
+		t.Error("expected execution to finish")
+	}
+	if *callErr != nil {
+		t.Errorf("call failed: %v", *callErr)
+	}
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	dbg := NewDebugger(false)
+	callee := common.BytesToAddress([]byte("callee"))
+	dbg.AddBreakpoint(Breakpoint{Kind: BreakAddress, Address: callee})
+	// 限定了其他地址的PC断点不会触发
+	dbg.AddBreakpoint(Breakpoint{Kind: BreakPC, Pc: 2, Address: common.BytesToAddress([]byte("other"))})
+	dbg.AddBreakpoint(Breakpoint{Kind: BreakPC, Pc: 2, Address: callee})
+	_, _, callErr := startDebugger(t, dbg)
+
+	if state := expectPause(t, dbg, callee, 0, PUSH1); state.Breakpoint.Kind != BreakAddress {
+		t.Errorf("unexpected breakpoint %v", state.Breakpoint)
+	}
+	dbg.Continue()
+	if state := expectPause(t, dbg, callee, 2, PUSH1); state.Breakpoint.ID != 3 {
+		t.Errorf("unexpected breakpoint %v", state.Breakpoint)
+	}
+	// 中止后不再暂停
+	dbg.Abort()
+	if _, ok := dbg.Wait(); ok {
+		t.Error("expected execution to finish after abort")
+	}
+	if !errors.Is(*callErr, ErrExecutionAborted) {
+		t.Errorf("unexpected error after abort: %v", *callErr)
+	}
+}
@@ -11,4 +11,8 @@ var (
 	ErrInsufficientBalance      = errors.New("insufficient balance for transfer")
 	ErrContractAddressCollision = errors.New("contract address collision")
 	ErrNoCompatibleInterpreter  = errors.New("no compatible interpreter")
+	ErrInvalidCode              = errors.New("invalid code: must not begin with 0xef")
+	ErrMaxInitCodeSizeExceeded  = errors.New("max initcode size exceeded")
+	ErrNoEWASMInterpreter       = errors.New("ewasm fork is enabled but no EWASMInterpreter is configured")
+	ErrExecutionAborted         = errors.New("execution aborted")
 )
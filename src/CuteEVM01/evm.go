@@ -25,11 +25,7 @@ type (
 // run运行给定的合约，并负责使用回退字节码解释器运行预编译。
 func run(evm *EVM, contract *Contract, input []byte, readOnly bool) ([]byte, error) {
 	if contract.CodeAddr != nil {
-		precompiles := PrecompiledContractsHomestead
-		if evm.ChainConfig().IsByzantium(evm.BlockNumber) {
-			precompiles = PrecompiledContractsByzantium
-		}
-		if p := precompiles[*contract.CodeAddr]; p != nil {
+		if p := evm.precompiles[*contract.CodeAddr]; p != nil {
 			return RunPrecompiledContract(p, input, contract)
 		}
 	}
@@ -42,12 +38,21 @@ func run(evm *EVM, contract *Contract, input []byte, readOnly bool) ([]byte, err
 				}(evm.interpreter)
 				evm.interpreter = interpreter
 			}
+			// 增加调用深度(被限制为1024)，对所有解释器都生效
+			evm.depth++
+			defer func() { evm.depth-- }()
+
 			return interpreter.Run(contract, input, readOnly)
 		}
 	}
 	return nil, ErrNoCompatibleInterpreter
 }
 
+// ActivePrecompiles 返回该EVM中生效的所有预编译合约地址(按升序排列)，包括通过 Config.Precompiles 注册的合约
+func (evm *EVM) ActivePrecompiles() []common.Address {
+	return sortedAddresses(evm.precompiles)
+}
+
 // Context为EVM提供附加信息。一旦提供，就不应该修改。
 type Context struct {
 	// CanTransfer返回帐户是否包含足够的ether来传输值
@@ -66,6 +71,7 @@ type Context struct {
 	GasLimit     uint64         // 为GASLIMIT提供信息
 	BlockNumber  *big.Int       // 为NUMBER提供信息
 	Time         *big.Int       // 为TIME提供信息
+	BaseFee      *big.Int       // 为BASEFEE提供信息(伦敦分叉之后)
 	Difficulty   *big.Int
 	TransferFunc func(StateDB, common.Address, common.Address, *big.Int)
 	// 为DIFFICULTY提供信息
@@ -87,6 +93,8 @@ type EVM struct {
 	chainConfig *params.ChainConfig
 	// chainRules 包含当前时代的链规则
 	chainRules params.Rules
+	// precompiles 当前分叉的预编译合约与 Config.Precompiles 合并后的结果
+	precompiles map[common.Address]PrecompiledContract
 	// virtual machine configuration options用于初始化虚拟机
 	vmConfig Config
 	// 全局(to this Context)ethereum虚拟机，在tx执行过程中使用。
@@ -97,6 +105,8 @@ type EVM struct {
 	abort int32
 	//callGasTemp保存当前调用可用的gas。这是必要的，因为可用gas是根据63/64规则在gasCall*中计算的，然后应用到opCall*中。
 	callGasTemp uint64
+	// err 是 NewEVM 遇到的配置错误(例如未注册的解释器)，之后的每次调用都直接返回它
+	err error
 }
 
 // NewEVM 返回一个新的虚拟机对象. 返回的虚拟机不是线程安全所以应该只被使用一次
@@ -109,31 +119,43 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig *params.ChainConfig, vmCon
 		chainRules:   chainConfig.Rules(ctx.BlockNumber),
 		interpreters: make([]Interpreter, 0, 1),
 	}
-
-	if chainConfig.IsEWASM(ctx.BlockNumber) {
-		// 由EVM-C和cart PRs实现
-		// if vmConfig.EWASMInterpreter != "" {
-		//  extIntOpts := strings.Split(vmConfig.EWASMInterpreter, ":")
-		//  path := extIntOpts[0]
-		//  options := []string{}
-		//  if len(extIntOpts) > 1 {
-		//    options = extIntOpts[1..]
-		//  }
-		//  evm.interpreters = append(evm.interpreters, NewEVMVCInterpreter(evm, vmConfig, options))
-		// } else {
-		// 	evm.interpreters = append(evm.interpreters, NewEWASMInterpreter(evm, vmConfig))
-		// }
-		panic("No supported ewasm interpreter yet.")
+	evm.precompiles = mergePrecompiles(activePrecompiledContracts(evm.chainRules), vmConfig.Precompiles)
+
+	// 通过名称选用已注册的解释器，run 按顺序以 CanRun 选择第一个能执行代码的解释器:
+	// EWASM解释器、外部EVM解释器，最后总是内置的EVM作为故障转移选项
+	// 配置错误不会panic，而是记录在 evm.err 中由 Err 和之后的每次调用返回
+	if vmConfig.EWASMInterpreter != "" {
+		evm.addInterpreter(vmConfig, vmConfig.EWASMInterpreter)
+	} else if chainConfig.IsEWASM(ctx.BlockNumber) {
+		evm.err = ErrNoEWASMInterpreter
+	}
+	if vmConfig.EVMInterpreter != "" {
+		evm.addInterpreter(vmConfig, vmConfig.EVMInterpreter)
 	}
-
-	// vmConfig。EVMInterpreter将被EVM-c使用，它不会在这里被检查，因为我们总是希望将内置的EVM作为故障转移选项。
 	evm.interpreters = append(evm.interpreters, NewEVMInterpreter(evm, vmConfig))
 	evm.interpreter = evm.interpreters[0]
 
 	return evm
 }
 
-//Cancel取消任何正在运行的EVM操作。这可以并发调用，并且可以安全地调用多次。
+// addInterpreter 创建配置的解释器并加入候选列表，失败时记录第一个错误
+func (evm *EVM) addInterpreter(cfg Config, spec string) {
+	interpreter, err := newInterpreter(evm, cfg, spec)
+	if err != nil {
+		if evm.err == nil {
+			evm.err = err
+		}
+		return
+	}
+	evm.interpreters = append(evm.interpreters, interpreter)
+}
+
+// Err 返回创建EVM时遇到的配置错误。出错的EVM不会执行任何代码，所有调用都返回该错误
+func (evm *EVM) Err() error {
+	return evm.err
+}
+
+//Cancel取消任何正在运行的EVM操作，被中止的执行以 ErrExecutionAborted 结束。这可以并发调用，并且可以安全地调用多次。
 func (evm *EVM) Cancel() {
 	atomic.StoreInt32(&evm.abort, 1)
 }
@@ -151,9 +173,16 @@ func (evm *EVM) Interpreter() Interpreter {
 // 调用使用给定的输入作为参数执行与addr关联的合约。
 // 它还处理所需的任何必要的value转移，并采取必要的步骤来创建帐户，并在执行错误或value转移失败时反转状态。
 func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
+	if evm.err != nil {
+		return nil, gas, evm.err
+	}
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
+	// 临时存储(EIP-1153)只在一次顶层执行内有效
+	if evm.depth == 0 {
+		defer evm.StateDB.ClearTransientStorage()
+	}
 
 	// 如果我们试图在调用深度限制之上执行，则会失败
 	if evm.depth > int(params.CallCreateDepth) {
@@ -169,15 +198,16 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		snapshot = evm.StateDB.Snapshot()
 	)
 	if !evm.StateDB.Exist(addr) {
-		precompiles := PrecompiledContractsHomestead
-		if evm.ChainConfig().IsByzantium(evm.BlockNumber) {
-			precompiles = PrecompiledContractsByzantium
-		}
-		if precompiles[addr] == nil && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
+		if evm.precompiles[addr] == nil && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
 			// 调用一个不存在的帐户，不做任何事情，但是ping the tracer
-			if evm.vmConfig.Debug && evm.depth == 0 {
-				_ = evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
-				_ = evm.vmConfig.Tracer.CaptureEnd(ret, 0, 0, nil)
+			if evm.vmConfig.Debug {
+				if evm.depth == 0 {
+					_ = evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
+					_ = evm.vmConfig.Tracer.CaptureEnd(ret, 0, 0, nil)
+				} else {
+					_ = evm.vmConfig.Tracer.CaptureEnter(CALL, caller.Address(), addr, input, gas, value)
+					_ = evm.vmConfig.Tracer.CaptureExit(ret, 0, nil)
+				}
 			}
 			return nil, gas, nil
 		}
@@ -192,13 +222,20 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	// 即使帐户没有代码，我们也需要继续，因为它可能是预编译的
 	start := time.Now()
 
-	// 在调试模式下捕获Tracer启动/结束事件
-	if evm.vmConfig.Debug && evm.depth == 0 {
-		_ = evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
+	// 在调试模式下捕获Tracer启动/结束事件，嵌套调用则捕获进入/退出调用帧事件
+	if evm.vmConfig.Debug {
+		if evm.depth == 0 {
+			_ = evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
 
-		defer func() { // 参数的延迟计算
-			_ = evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
-		}()
+			defer func() { // 参数的延迟计算
+				_ = evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
+			}()
+		} else {
+			_ = evm.vmConfig.Tracer.CaptureEnter(CALL, caller.Address(), addr, input, gas, value)
+			defer func() {
+				_ = evm.vmConfig.Tracer.CaptureExit(ret, gas-leftOverGas, err)
+			}()
+		}
 	}
 	ret, err = run(evm, contract, input, false)
 
@@ -210,7 +247,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 			contract.UseGas(contract.Gas)
 		}
 	}
-	return ret, contract.Gas, err
+	return ret, contract.Gas, evm.wrapRevert(ret, err)
 }
 
 // CallCode使用给定的输入作为参数执行与addr关联的合约。
@@ -218,6 +255,9 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 //
 // CallCode与Call的不同之处在于，它以调用者作为上下文执行给定的地址的代码
 func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
+	if evm.err != nil {
+		return nil, gas, evm.err
+	}
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
@@ -239,6 +279,12 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	contract := NewContract(caller, to, value, gas)
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if evm.vmConfig.Debug {
+		_ = evm.vmConfig.Tracer.CaptureEnter(CALLCODE, caller.Address(), addr, input, gas, value)
+		defer func() {
+			_ = evm.vmConfig.Tracer.CaptureExit(ret, gas-leftOverGas, err)
+		}()
+	}
 	ret, err = run(evm, contract, input, false)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
@@ -246,13 +292,16 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 			contract.UseGas(contract.Gas)
 		}
 	}
-	return ret, contract.Gas, err
+	return ret, contract.Gas, evm.wrapRevert(ret, err)
 }
 
 // DelegateCall使用给定的输入作为参数执行与addr关联的合约。它会在执行错误时反转状态。
 //
 // delegateCall与CallCode的不同之处在于，它使用调用者作为上下文执行给定的地址代码，并将调用者设置为调用者的调用者。
 func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []byte, gas uint64) (ret []byte, leftOverGas uint64, err error) {
+	if evm.err != nil {
+		return nil, gas, evm.err
+	}
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
@@ -270,6 +319,13 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	contract := NewContract(caller, to, nil, gas).AsDelegate()
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if evm.vmConfig.Debug {
+		// DELEGATECALL继承调用者的value
+		_ = evm.vmConfig.Tracer.CaptureEnter(DELEGATECALL, caller.Address(), addr, input, gas, contract.value)
+		defer func() {
+			_ = evm.vmConfig.Tracer.CaptureExit(ret, gas-leftOverGas, err)
+		}()
+	}
 	ret, err = run(evm, contract, input, false)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
@@ -277,12 +333,15 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 			contract.UseGas(contract.Gas)
 		}
 	}
-	return ret, contract.Gas, err
+	return ret, contract.Gas, evm.wrapRevert(ret, err)
 }
 
 // StaticCall使用给定的输入作为参数执行与addr关联的合约，同时不允许在调用期间对状态进行任何修改。
 // 试图执行此类修改的OpCode将导致异常而不是执行修改。
 func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte, gas uint64) (ret []byte, leftOverGas uint64, err error) {
+	if evm.err != nil {
+		return nil, gas, evm.err
+	}
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
@@ -305,6 +364,13 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	// future scenarios
 	evm.StateDB.AddBalance(addr, bigZero)
 
+	if evm.vmConfig.Debug {
+		_ = evm.vmConfig.Tracer.CaptureEnter(STATICCALL, caller.Address(), addr, input, gas, nil)
+		defer func() {
+			_ = evm.vmConfig.Tracer.CaptureExit(ret, gas-leftOverGas, err)
+		}()
+	}
+
 	//当EVM返回错误或设置上面的创建代码时，我们将恢复到快照并且消耗掉剩余的任何gas
 	// 此外，当我们处在HomeStead指令集下，这也计算代码存储gas错误。
 	ret, err = run(evm, contract, input, true)
@@ -314,7 +380,7 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 			contract.UseGas(contract.Gas)
 		}
 	}
-	return ret, contract.Gas, err
+	return ret, contract.Gas, evm.wrapRevert(ret, err)
 }
 
 type codeAndHash struct {
@@ -330,11 +396,18 @@ func (c *codeAndHash) Hash() common.Hash {
 }
 
 // create 使用代码作为部署代码创建一个新合约。
-func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, address common.Address) ([]byte, common.Address, uint64, error) {
+func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, address common.Address, typ OpCode) ([]byte, common.Address, uint64, error) {
+	if evm.err != nil {
+		return nil, common.Address{}, gas, evm.err
+	}
 	// 深度检查执行
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, common.Address{}, gas, ErrDepth
 	}
+	// 临时存储(EIP-1153)只在一次顶层执行内有效
+	if evm.depth == 0 {
+		defer evm.StateDB.ClearTransientStorage()
+	}
 	if !evm.CanTransfer(evm.StateDB, caller.Address(), value) {
 		return nil, common.Address{}, gas, ErrInsufficientBalance
 	}
@@ -346,6 +419,10 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	if evm.StateDB.GetNonce(address) != 0 || (contractHash != (common.Hash{}) && contractHash != emptyCodeHash) {
 		return nil, common.Address{}, 0, ErrContractAddressCollision
 	}
+	// EIP-2929: 新合约的地址在快照之前加入访问列表，即使创建失败也不会被回滚
+	if evm.chainRules.IsBerlin {
+		evm.StateDB.AddAddressToAccessList(address)
+	}
 	// 在该状态上创建一个新帐户
 	snapshot := evm.StateDB.Snapshot()
 	evm.StateDB.CreateAccount(address)
@@ -361,8 +438,12 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 		return nil, address, gas, nil
 	}
 
-	if evm.vmConfig.Debug && evm.depth == 0 {
-		_ = evm.vmConfig.Tracer.CaptureStart(caller.Address(), address, true, codeAndHash.code, gas, value)
+	if evm.vmConfig.Debug {
+		if evm.depth == 0 {
+			_ = evm.vmConfig.Tracer.CaptureStart(caller.Address(), address, true, codeAndHash.code, gas, value)
+		} else {
+			_ = evm.vmConfig.Tracer.CaptureEnter(typ, caller.Address(), address, codeAndHash.code, gas, value)
+		}
 	}
 	start := time.Now()
 
@@ -370,6 +451,10 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 
 	// 检查是否超过了最大代码大小
 	maxCodeSizeExceeded := evm.ChainConfig().IsEIP158(evm.BlockNumber) && len(ret) > params.MaxCodeSize
+	// EIP-3541: 伦敦分叉之后拒绝部署以0xEF开头的代码
+	if err == nil && len(ret) >= 1 && ret[0] == 0xEF && evm.chainRules.IsLondon {
+		err = ErrInvalidCode
+	}
 	//如果合约创建运行成功且没有返回错误，则计算存储代码所需的gas。
 	//如果代码不能存储由于没有足够的gas设置一个错误，并让它处理的错误检查条件如下。
 	if err == nil && !maxCodeSizeExceeded {
@@ -394,8 +479,13 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	if maxCodeSizeExceeded && err == nil {
 		err = errMaxCodeSizeExceeded
 	}
-	if evm.vmConfig.Debug && evm.depth == 0 {
-		_ = evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
+	err = evm.wrapRevert(ret, err)
+	if evm.vmConfig.Debug {
+		if evm.depth == 0 {
+			_ = evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
+		} else {
+			_ = evm.vmConfig.Tracer.CaptureExit(ret, gas-contract.Gas, err)
+		}
 	}
 	return ret, address, contract.Gas, err
 
@@ -404,7 +494,7 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 // Create使用代码作为部署代码创建一个新合约
 func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
 	contractAddr = crypto.CreateAddress(caller.Address(), evm.StateDB.GetNonce(caller.Address()))
-	return evm.create(caller, &codeAndHash{code: code}, gas, value, contractAddr)
+	return evm.create(caller, &codeAndHash{code: code}, gas, value, contractAddr, CREATE)
 }
 
 // Create2 使用代码作为部署代码创建一个新合约
@@ -414,7 +504,7 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *big.Int, salt *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
 	codeAndHash := &codeAndHash{code: code}
 	contractAddr = crypto.CreateAddress2(caller.Address(), common.BigToHash(salt), codeAndHash.Hash().Bytes())
-	return evm.create(caller, codeAndHash, gas, endowment, contractAddr)
+	return evm.create(caller, codeAndHash, gas, endowment, contractAddr, CREATE2)
 }
 
 // ChainConfig 环境的chain configuration
@@ -0,0 +1,445 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/params"
+)
+
+// fuzzPoolSize 是模糊测试中预先部署的测试合约数量，执行总是从第一个合约开始
+const fuzzPoolSize = 4
+
+var (
+	fuzzOrigin = common.BytesToAddress([]byte("fuzz origin"))
+	fuzzPool   = func() []common.Address {
+		pool := make([]common.Address, fuzzPoolSize)
+		for i := range pool {
+			pool[i] = common.BigToAddress(big.NewInt(int64(0xc0de00 + i)))
+		}
+		return pool
+	}()
+	// fuzzCallTargets 是生成的调用指令可以使用的目标: 测试合约池、identity预编译合约和一个不存在的账户
+	fuzzCallTargets = append(append([]common.Address{}, fuzzPool...), common.BytesToAddress([]byte{4}), common.BytesToAddress([]byte("nobody")))
+)
+
+// fuzzInput 是按需读取的模糊输入，读完之后总是返回0，
+// 因此任意输入(包括空输入)都能生成完整的程序
+type fuzzInput []byte
+
+func (in *fuzzInput) next() byte {
+	if len(*in) == 0 {
+		return 0
+	}
+	b := (*in)[0]
+	*in = (*in)[1:]
+	return b
+}
+
+func (in *fuzzInput) bytes(n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = in.next()
+	}
+	return out
+}
+
+// fuzzProgram 根据模糊输入生成格式良好的字节码: PUSH指令总是带有完整的立即数，
+// 跳转只以之后生成的JUMPDEST为目标(因此不会出现死循环)，调用指令只以 fuzzCallTargets 为目标
+type fuzzProgram struct {
+	in      *fuzzInput
+	jt      *[256]operation
+	code    []byte
+	height  int      // 顺序执行到当前位置时的堆栈高度
+	pending []int    // 等待下一个JUMPDEST回填的PUSH2立即数位置
+	targets []uint64 // 所有跳转的目标
+}
+
+// generateFuzzProgram 从输入中生成一个合约的字节码，第一个字节决定指令数量
+func generateFuzzProgram(in *fuzzInput, jt *[256]operation) *fuzzProgram {
+	p := &fuzzProgram{in: in, jt: jt}
+	for n := int(in.next()); n > 0; n-- {
+		switch in.next() % 16 {
+		case 0:
+			p.push(in.bytes(1 + int(in.next()%32)))
+		case 1:
+			p.jump(false)
+		case 2:
+			p.jump(true)
+		case 3:
+			p.jumpdest()
+		case 4, 5:
+			p.call()
+		case 6:
+			p.push1(in.next())
+			p.push1(in.next() % 4)
+			p.op(SSTORE)
+		case 7:
+			p.push1(in.next() % 4)
+			p.op(SLOAD)
+		case 8:
+			p.push1(in.next())
+			p.push1(in.next() % 64)
+			p.op(MSTORE8)
+		case 9:
+			p.create()
+		case 10:
+			p.push(fuzzCallTargets[int(in.next())%len(fuzzCallTargets)].Bytes())
+			p.op(SELFDESTRUCT)
+		case 11:
+			p.terminate()
+		default:
+			p.generic(OpCode(in.next()))
+		}
+	}
+	if len(p.pending) > 0 {
+		p.jumpdest()
+	}
+	p.terminate()
+	return p
+}
+
+// push 生成一条以value为立即数的PUSH指令
+func (p *fuzzProgram) push(value []byte) {
+	p.code = append(p.code, byte(PUSH1)+byte(len(value)-1))
+	p.code = append(p.code, value...)
+	p.height++
+}
+
+func (p *fuzzProgram) push1(value byte) {
+	p.push([]byte{value})
+}
+
+// op 生成一条指令，堆栈项不够时先用输入中的值补足
+func (p *fuzzProgram) op(op OpCode) {
+	operation := &p.jt[op]
+	pops := operation.minStack
+	pushes := int(params.StackLimit) + pops - operation.maxStack
+	for p.height < pops {
+		p.push1(p.in.next())
+	}
+	p.code = append(p.code, byte(op))
+	p.height += pushes - pops
+}
+
+// jump 生成一条跳转到下一个JUMPDEST的JUMP或JUMPI
+func (p *fuzzProgram) jump(conditional bool) {
+	if conditional {
+		p.push1(p.in.next() % 2)
+	}
+	p.pending = append(p.pending, len(p.code)+1)
+	p.push([]byte{0, 0})
+	if conditional {
+		p.op(JUMPI)
+	} else {
+		p.op(JUMP)
+	}
+}
+
+// jumpdest 生成一个JUMPDEST并回填之前所有等待中的跳转
+func (p *fuzzProgram) jumpdest() {
+	dest := len(p.code)
+	for _, pos := range p.pending {
+		binary.BigEndian.PutUint16(p.code[pos:], uint16(dest))
+		p.targets = append(p.targets, uint64(dest))
+	}
+	p.pending = p.pending[:0]
+	p.op(JUMPDEST)
+}
+
+// call 生成一个参数完整的CALL、CALLCODE、DELEGATECALL或STATICCALL
+func (p *fuzzProgram) call() {
+	op := []OpCode{CALL, CALLCODE, DELEGATECALL, STATICCALL}[p.in.next()%4]
+	p.push1(p.in.next() % 64) // retSize
+	p.push1(p.in.next() % 64) // retOffset
+	p.push1(p.in.next() % 64) // argsSize
+	p.push1(p.in.next() % 64) // argsOffset
+	if op == CALL || op == CALLCODE {
+		p.push1(p.in.next() % 4)
+	}
+	p.push(fuzzCallTargets[int(p.in.next())%len(fuzzCallTargets)].Bytes())
+	if p.in.next()%2 == 0 {
+		p.op(GAS)
+	} else {
+		p.push(p.in.bytes(3))
+	}
+	p.op(op)
+}
+
+// create 生成一个以内存中的数据为初始化代码的CREATE或CREATE2
+func (p *fuzzProgram) create() {
+	op := CREATE
+	if p.in.next()%2 == 1 {
+		op = CREATE2
+		p.push1(p.in.next()) // salt
+	}
+	p.push1(p.in.next() % 64) // size
+	p.push1(p.in.next() % 64) // offset
+	p.push1(p.in.next() % 2)  // value
+	p.op(op)
+}
+
+// terminate 生成STOP、RETURN或REVERT
+func (p *fuzzProgram) terminate() {
+	switch p.in.next() % 3 {
+	case 0:
+		p.op(STOP)
+	case 1, 2:
+		op := RETURN
+		if p.in.next()%2 == 1 {
+			op = REVERT
+		}
+		p.push1(p.in.next() % 64) // size
+		p.push1(p.in.next() % 64) // offset
+		p.op(op)
+	}
+}
+
+// generic 生成一条不需要特殊处理的指令，无效的和由其他生成函数负责的指令被忽略
+func (p *fuzzProgram) generic(op OpCode) {
+	if !p.jt[op].valid || op.IsPush() {
+		return
+	}
+	switch op {
+	case JUMP, JUMPI, JUMPDEST, CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE, CREATE2, SELFDESTRUCT:
+		return
+	}
+	p.op(op)
+}
+
+// invariantTracer 在执行过程中检查gas、退款和状态回滚的不变量，只记录第一个违反的不变量
+type invariantTracer struct {
+	state     *state.StateDB
+	rules     params.Rules
+	frames    []uint64     // 每个调用帧中上一步执行前的剩余gas，帧开始时为分配给它的gas
+	entries   []*fuzzEntry // 每个子调用帧进入之前的状态，与 frames[1:] 对应
+	pending   *fuzzEntry   // 当前调用或创建指令执行之前的状态
+	refund    uint64       // 上一步执行前的退款计数器
+	violation error
+}
+
+// fuzzEntry 是子调用帧开始之前(即调用者的快照处)的状态根和退款计数器
+type fuzzEntry struct {
+	root   common.Hash
+	refund uint64
+}
+
+func (t *invariantTracer) fail(format string, args ...interface{}) {
+	if t.violation == nil {
+		t.violation = fmt.Errorf(format, args...)
+	}
+}
+
+// maxRefund 返回按照分叉规则一条指令最多能增加的退款
+func (t *invariantTracer) maxRefund(op OpCode) uint64 {
+	switch op {
+	case SSTORE:
+		// 把同一交易中新建的存储槽恢复为0时的退款最多
+		if t.rules.IsBerlin {
+			return params.SstoreInitGasEIP2200 - params.WarmStorageReadCostEIP2929
+		}
+		return params.SstoreInitRefundEIP2200
+	case SELFDESTRUCT:
+		// EIP-3529: 伦敦分叉之后自毁不再退款
+		if !t.rules.IsLondon {
+			return params.SuicideRefundGas
+		}
+	}
+	return 0
+}
+
+// snapshot 返回调用或创建指令进入子调用帧时调用者快照处的状态。创建指令在快照之前增加创建者的nonce
+func (t *invariantTracer) snapshot(op OpCode, contract *Contract) *fuzzEntry {
+	cpy := t.state.Copy()
+	if op == CREATE || op == CREATE2 {
+		cpy.SetNonce(contract.Address(), cpy.GetNonce(contract.Address())+1)
+	}
+	return &fuzzEntry{root: cpy.IntermediateRoot(true), refund: t.refund}
+}
+
+func (t *invariantTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.frames = append(t.frames[:0], gas)
+	t.entries, t.pending = t.entries[:0], nil
+	t.refund = t.state.GetRefund()
+	return nil
+}
+
+func (t *invariantTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if depth != len(t.frames) {
+		t.fail("pc %d %v: depth %d, have %d frames", pc, op, depth, len(t.frames))
+		return nil
+	}
+	if last := &t.frames[len(t.frames)-1]; gas > *last {
+		t.fail("depth %d pc %d %v: gas increased from %d to %d", depth, pc, op, *last, gas)
+	} else {
+		*last = gas
+	}
+	// 退款在指令的gas计算中增加，回滚的调用帧只会减少退款
+	refund := t.state.GetRefund()
+	if refund > t.refund && refund-t.refund > t.maxRefund(op) {
+		t.fail("depth %d pc %d %v: refund increased by %d, at most %d", depth, pc, op, refund-t.refund, t.maxRefund(op))
+	}
+	t.refund = refund
+
+	t.pending = nil
+	if err == nil {
+		switch op {
+		case CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE, CREATE2:
+			t.pending = t.snapshot(op, contract)
+		}
+	}
+	return nil
+}
+
+func (t *invariantTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+func (t *invariantTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if len(t.frames) != 1 {
+		t.fail("execution ended with %d frames", len(t.frames))
+	}
+	return nil
+}
+
+func (t *invariantTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	if t.pending == nil {
+		t.fail("%v entered without a call instruction", typ)
+	}
+	t.frames = append(t.frames, gas)
+	t.entries = append(t.entries, t.pending)
+	t.pending = nil
+	return nil
+}
+
+func (t *invariantTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	if len(t.frames) < 2 {
+		t.fail("exit without matching enter")
+		return nil
+	}
+	t.frames = t.frames[:len(t.frames)-1]
+	entry := t.entries[len(t.entries)-1]
+	t.entries = t.entries[:len(t.entries)-1]
+
+	// 失败的子调用帧回滚到进入之前的状态
+	t.refund = t.state.GetRefund()
+	if err != nil && entry != nil {
+		if t.refund != entry.refund {
+			t.fail("failed frame (%v) left refund %d, had %d", err, t.refund, entry.refund)
+		}
+		if root := t.state.Copy().IntermediateRoot(true); root != entry.root {
+			t.fail("failed frame (%v) changed state root from %x to %x", err, entry.root, root)
+		}
+	}
+	return nil
+}
+
+// runFuzzInput 部署由输入生成的测试合约池，从第一个合约开始执行，并检查执行后的不变量:
+//   - 每个调用帧中剩余的gas从不增加
+//   - 退款只在SSTORE(伦敦之前还有SELFDESTRUCT)中增加，且不超过分叉规则下一条指令最多能产生的退款
+//   - 按状态转换的规则应用退款(不超过已用gas除以分叉的退款系数)后，返还的gas不超过提供的gas
+//   - 失败的子调用帧和顶层调用的状态根和退款计数器与进入之前相同
+//   - 整数池中的值没有被修改(需要以 -tags VERIFY_EVM_INTEGER_POOL 构建才会检查)
+func runFuzzInput(data []byte) error {
+	var (
+		in         = fuzzInput(data)
+		statedb, _ = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		tracer     = &invariantTracer{state: statedb}
+	)
+	vmctx := Context{
+		CanTransfer: func(db StateDB, addr common.Address, amount *big.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		},
+		Transfer: func(db StateDB, sender, recipient common.Address, amount *big.Int) {
+			db.SubBalance(sender, amount)
+			db.AddBalance(recipient, amount)
+		},
+		GetHash:     func(n uint64) common.Hash { return common.BigToHash(new(big.Int).SetUint64(n)) },
+		Origin:      fuzzOrigin,
+		GasPrice:    big.NewInt(1),
+		GasLimit:    10000000,
+		BlockNumber: big.NewInt(1),
+		Time:        big.NewInt(1),
+		BaseFee:     big.NewInt(1),
+		Difficulty:  big.NewInt(1),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: tracer})
+	tracer.rules = vmenv.chainRules
+	jt := &vmenv.interpreters[len(vmenv.interpreters)-1].(*EVMInterpreter).cfg.JumpTable
+
+	statedb.SetBalance(fuzzOrigin, big.NewInt(1000000000))
+	for _, addr := range fuzzPool {
+		program := generateFuzzProgram(&in, jt)
+		contract := NewContract(AccountRef(fuzzOrigin), AccountRef(addr), new(big.Int), 0)
+		contract.SetCallCode(&addr, common.Hash{}, program.code)
+		for _, dest := range program.targets {
+			if !contract.validJumpdest(new(big.Int).SetUint64(dest)) {
+				return fmt.Errorf("contract %x: generated jump to invalid destination %d", addr, dest)
+			}
+		}
+		statedb.SetCode(addr, program.code)
+		statedb.SetBalance(addr, big.NewInt(100))
+	}
+	root := statedb.IntermediateRoot(true)
+
+	value := new(big.Int).SetUint64(uint64(in.next() % 2))
+	gas := uint64(1000000)
+	_, leftOver, err := vmenv.Call(AccountRef(fuzzOrigin), fuzzPool[0], in.bytes(int(in.next()%64)), gas, value)
+
+	if tracer.violation != nil {
+		return tracer.violation
+	}
+	if leftOver > gas {
+		return fmt.Errorf("gas increased from %d to %d", gas, leftOver)
+	}
+	// 与状态转换一样，退款不超过已用gas除以分叉的退款系数
+	refund, used := statedb.GetRefund(), gas-leftOver
+	quotient := params.RefundQuotient
+	if tracer.rules.IsLondon {
+		quotient = params.RefundQuotientEIP3529
+	}
+	applied := used / quotient
+	if applied > refund {
+		applied = refund
+	}
+	if leftOver+applied > gas {
+		return fmt.Errorf("refund %d of %d used gas (counter %d) returns %d of %d gas", applied, used, refund, leftOver+applied, gas)
+	}
+	if err != nil {
+		if refund != 0 {
+			return fmt.Errorf("failed execution (%v) left refund %d", err, refund)
+		}
+		if have := statedb.IntermediateRoot(true); have != root {
+			return fmt.Errorf("failed execution (%v) changed state root from %x to %x", err, root, have)
+		}
+	}
+	poolOfIntPools.lock.Lock()
+	defer poolOfIntPools.lock.Unlock()
+	for _, pool := range poolOfIntPools.pools {
+		verifyIntegerPool(pool)
+	}
+	return nil
+}
+
+// FuzzExecution 对生成的格式良好的合约检查执行不变量，
+// 以 go test -fuzz FuzzExecution -tags VERIFY_EVM_INTEGER_POOL 运行可以同时检查整数池
+func FuzzExecution(f *testing.F) {
+	f.Add([]byte{})
+	// 两次SSTORE后以CALL调用自身，然后REVERT
+	f.Add([]byte{3, 6, 1, 0, 6, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 11, 1, 1, 0, 0})
+	// 条件跳转、跳转目标以及对池中其他合约的调用
+	f.Add([]byte{8, 2, 1, 4, 0, 32, 32, 0, 0, 1, 1, 1, 3, 6, 5, 1, 4, 2, 0, 0, 0, 0, 1, 0, 0, 16, 1, 5, 0, 1, 0x40,
+		4, 0, 8, 2, 0x01, 6, 0, 0, 3, 9, 1, 7, 5, 8, 1, 0, 0, 0, 1, 0x20})
+	f.Add([]byte("0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := runFuzzInput(data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
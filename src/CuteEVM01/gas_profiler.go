@@ -0,0 +1,282 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/crypto"
+	"CuteEVM01/Out/params"
+)
+
+// GasProfileEntry 是一段代码中某一条指令(由代码哈希和PC确定)的gas统计
+type GasProfileEntry struct {
+	CodeHash    common.Hash `json:"codeHash"`
+	Pc          uint64      `json:"pc"`
+	Op          OpCode      `json:"op"`
+	Count       uint64      `json:"count"`       // 执行次数
+	ConstantGas uint64      `json:"constantGas"` // 指令的固定gas总和
+	DynamicGas  uint64      `json:"dynamicGas"`  // 动态gas总和，不包括内存扩展和转给子调用的gas
+	MemoryGas   uint64      `json:"memoryGas"`   // 内存扩展的gas总和
+}
+
+// TotalGas 返回该指令消耗的全部gas
+func (e *GasProfileEntry) TotalGas() uint64 {
+	return e.ConstantGas + e.DynamicGas + e.MemoryGas
+}
+
+// ContractGasProfile 是同一段代码(由代码哈希确定)中所有指令的gas统计之和
+type ContractGasProfile struct {
+	CodeHash    common.Hash `json:"codeHash"`
+	Count       uint64      `json:"count"`
+	ConstantGas uint64      `json:"constantGas"`
+	DynamicGas  uint64      `json:"dynamicGas"`
+	MemoryGas   uint64      `json:"memoryGas"`
+}
+
+// TotalGas 返回该代码消耗的全部gas
+func (c *ContractGasProfile) TotalGas() uint64 {
+	return c.ConstantGas + c.DynamicGas + c.MemoryGas
+}
+
+// profileKey 确定一条指令
+type profileKey struct {
+	codeHash common.Hash
+	pc       uint64
+}
+
+// profileFrame 是 GasProfiler 在每个调用帧中维护的状态
+type profileFrame struct {
+	codeHash common.Hash
+	hashed   bool             // codeHash 是否已经确定
+	memGas   uint64           // 该帧内存中已经计费的扩展gas
+	last     *GasProfileEntry // 该帧最近执行的指令
+	sample   *profileSample   // 该帧最近执行的指令所在的调用栈样本
+	stepped  bool             // 该帧是否执行过任何指令(预编译合约不会)
+	create   bool             // 该帧是否为合约创建
+}
+
+// profileSample 是一个调用栈(从最内层到最外层的指令)上的累计值
+type profileSample struct {
+	stack []profileKey
+	count int64
+	gas   int64
+}
+
+// GasProfiler 是一个实现了 Tracer 的gas分析器。
+//
+// 它按代码哈希和PC汇总每条指令的执行次数、固定gas、动态gas(即传给 CaptureState 的 cost)和内存扩展gas。
+// 调用类指令转给子调用的gas不计入调用者的动态gas，由子调用中的指令各自计算(预编译合约消耗的gas
+// 仍计入调用指令)；没有进入子调用(例如余额不足或超过调用深度)时这部分gas退还给调用者，同样不计入。合约创建成功后的代码存储gas计入返回代码的指令(通常是RETURN)的动态gas。
+// 因此执行成功时所有指令的 TotalGas 之和等于执行实际消耗的gas；执行失败时剩余的gas被直接扣除，不计入任何指令。
+// 结果可以通过 Entries 和 Contracts 按消耗排序获取，也可以通过 WriteProfile 导出为pprof格式
+type GasProfiler struct {
+	entries map[profileKey]*GasProfileEntry
+	samples map[string]*profileSample
+	frames  []*profileFrame
+}
+
+// NewGasProfiler 返回一个新的gas分析器
+func NewGasProfiler() *GasProfiler {
+	return &GasProfiler{
+		entries: make(map[profileKey]*GasProfileEntry),
+		samples: make(map[string]*profileSample),
+	}
+}
+
+// CaptureStart 为顶层调用创建调用帧
+func (p *GasProfiler) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	p.frames = append(p.frames[:0], &profileFrame{create: create})
+	return nil
+}
+
+// CaptureState 统计一条指令的gas
+func (p *GasProfiler) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if err != nil || len(p.frames) == 0 {
+		return nil
+	}
+	frame := p.frames[len(p.frames)-1]
+	if !frame.hashed {
+		frame.codeHash, frame.hashed = contract.CodeHash, true
+		if frame.codeHash == (common.Hash{}) {
+			frame.codeHash = crypto.Keccak256Hash(contract.Code)
+		}
+	}
+	var constantGas uint64
+	if in, ok := env.interpreter.(*EVMInterpreter); ok {
+		constantGas = in.cfg.JumpTable[op].constantGas
+	}
+	// 内存扩展gas包含在 cost 中，由内存已计费的总额计算出本次扩展的部分
+	memGas := memory.lastGasCost - frame.memGas
+	if memGas > cost {
+		memGas = cost
+	}
+	frame.memGas = memory.lastGasCost
+
+	// 调用类指令的 cost 包含转给子调用的gas。转账调用附带的津贴不在 cost 中，但它没有用掉的部分
+	// 会和转出的gas一起返还给调用者(调用失败时全部返还)，因此也从调用指令的gas中扣除
+	dynamicGas := cost - memGas
+	switch op {
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+		forwarded := env.callGasTemp
+		if (op == CALL || op == CALLCODE) && stack.Back(2).Sign() != 0 {
+			forwarded += params.CallStipend
+		}
+		if forwarded > dynamicGas {
+			forwarded = dynamicGas
+		}
+		dynamicGas -= forwarded
+	}
+
+	key := profileKey{frame.codeHash, pc}
+	entry := p.entries[key]
+	if entry == nil {
+		entry = &GasProfileEntry{CodeHash: frame.codeHash, Pc: pc, Op: op}
+		p.entries[key] = entry
+	}
+	entry.Count++
+	entry.ConstantGas += constantGas
+	entry.DynamicGas += dynamicGas
+	entry.MemoryGas += memGas
+
+	frame.last, frame.stepped = entry, true
+	frame.sample = p.sample(key)
+	frame.sample.count++
+	frame.sample.gas += int64(constantGas + dynamicGas + memGas)
+	return nil
+}
+
+// CaptureFault 实现 Tracer 接口
+func (p *GasProfiler) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd 统计顶层合约创建的代码存储gas
+func (p *GasProfiler) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	if len(p.frames) > 0 {
+		p.deposit(p.frames[len(p.frames)-1], output, err)
+	}
+	return nil
+}
+
+// deposit 将合约创建成功后的代码存储gas计入该帧最后执行的指令
+func (p *GasProfiler) deposit(frame *profileFrame, output []byte, err error) {
+	if !frame.create || err != nil || frame.last == nil {
+		return
+	}
+	gas := uint64(len(output)) * params.CreateDataGas
+	frame.last.DynamicGas += gas
+	frame.sample.gas += int64(gas)
+}
+
+// CaptureEnter 为子调用创建调用帧
+func (p *GasProfiler) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	if len(p.frames) == 0 {
+		return nil
+	}
+	p.frames = append(p.frames, &profileFrame{create: typ == CREATE || typ == CREATE2})
+	return nil
+}
+
+// CaptureExit 弹出当前调用帧并统计代码存储gas。没有执行任何指令的子调用(预编译合约)消耗的gas计入调用指令
+func (p *GasProfiler) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	if len(p.frames) < 2 {
+		return nil
+	}
+	frame := p.frames[len(p.frames)-1]
+	p.frames = p.frames[:len(p.frames)-1]
+	p.deposit(frame, output, err)
+
+	if parent := p.frames[len(p.frames)-1]; !frame.stepped && parent.last != nil {
+		parent.last.DynamicGas += gasUsed
+		parent.sample.gas += int64(gasUsed)
+	}
+	return nil
+}
+
+// sample 返回当前调用栈以 key 为最内层指令的样本
+func (p *GasProfiler) sample(key profileKey) *profileSample {
+	stack := []profileKey{key}
+	for i := len(p.frames) - 2; i >= 0; i-- {
+		if last := p.frames[i].last; last != nil {
+			stack = append(stack, profileKey{last.CodeHash, last.Pc})
+		}
+	}
+	id := make([]string, len(stack))
+	for i, k := range stack {
+		id[i] = fmt.Sprintf("%x:%d", k.codeHash, k.pc)
+	}
+	s := p.samples[strings.Join(id, "/")]
+	if s == nil {
+		s = &profileSample{stack: stack}
+		p.samples[strings.Join(id, "/")] = s
+	}
+	return s
+}
+
+// Entries 返回所有指令的统计，按消耗的gas从高到低排序
+func (p *GasProfiler) Entries() []*GasProfileEntry {
+	entries := make([]*GasProfileEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.TotalGas() != b.TotalGas() {
+			return a.TotalGas() > b.TotalGas()
+		}
+		if a.CodeHash != b.CodeHash {
+			return a.CodeHash.Big().Cmp(b.CodeHash.Big()) < 0
+		}
+		return a.Pc < b.Pc
+	})
+	return entries
+}
+
+// Contracts 返回按代码哈希汇总的统计，按消耗的gas从高到低排序
+func (p *GasProfiler) Contracts() []*ContractGasProfile {
+	byHash := make(map[common.Hash]*ContractGasProfile)
+	for _, entry := range p.entries {
+		c := byHash[entry.CodeHash]
+		if c == nil {
+			c = &ContractGasProfile{CodeHash: entry.CodeHash}
+			byHash[entry.CodeHash] = c
+		}
+		c.Count += entry.Count
+		c.ConstantGas += entry.ConstantGas
+		c.DynamicGas += entry.DynamicGas
+		c.MemoryGas += entry.MemoryGas
+	}
+	contracts := make([]*ContractGasProfile, 0, len(byHash))
+	for _, c := range byHash {
+		contracts = append(contracts, c)
+	}
+	sort.Slice(contracts, func(i, j int) bool {
+		a, b := contracts[i], contracts[j]
+		if a.TotalGas() != b.TotalGas() {
+			return a.TotalGas() > b.TotalGas()
+		}
+		return a.CodeHash.Big().Cmp(b.CodeHash.Big()) < 0
+	})
+	return contracts
+}
+
+// WriteReport 将按消耗排序的统计以可读的格式写入给定的writer，limit 为0时输出所有指令
+func (p *GasProfiler) WriteReport(writer io.Writer, limit int) {
+	fmt.Fprintln(writer, "Contracts:")
+	for _, c := range p.Contracts() {
+		fmt.Fprintf(writer, "%x total=%d count=%d constant=%d dynamic=%d memory=%d\n", c.CodeHash, c.TotalGas(), c.Count, c.ConstantGas, c.DynamicGas, c.MemoryGas)
+	}
+	fmt.Fprintln(writer)
+	fmt.Fprintln(writer, "Instructions:")
+	for i, e := range p.Entries() {
+		if limit != 0 && i >= limit {
+			break
+		}
+		fmt.Fprintf(writer, "%x pc=%08d %-16s total=%d count=%d constant=%d dynamic=%d memory=%d\n", e.CodeHash, e.Pc, e.Op, e.TotalGas(), e.Count, e.ConstantGas, e.DynamicGas, e.MemoryGas)
+	}
+}
@@ -0,0 +1,195 @@
+package vm
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// 以下是pprof使用的 profile.proto 中用到的字段编号
+const (
+	pbProfileSampleType  = 1
+	pbProfileSample      = 2
+	pbProfileLocation    = 4
+	pbProfileFunction    = 5
+	pbProfileStringTable = 6
+	pbProfilePeriodType  = 11
+	pbProfilePeriod      = 12
+
+	pbValueTypeType = 1
+	pbValueTypeUnit = 2
+
+	pbSampleLocationID = 1
+	pbSampleValue      = 2
+
+	pbLocationID      = 1
+	pbLocationAddress = 3
+	pbLocationLine    = 4
+
+	pbLineFunctionID = 1
+	pbLineLine       = 2
+
+	pbFunctionID         = 1
+	pbFunctionName       = 2
+	pbFunctionSystemName = 3
+	pbFunctionFilename   = 4
+)
+
+// protoBuffer 是一个最简单的protobuf编码器，只支持 profile.proto 需要的varint和length-delimited字段
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) uint64(tag int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(tag)<<3 | 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(tag int, x int64) {
+	b.uint64(tag, uint64(x))
+}
+
+func (b *protoBuffer) bytes(tag int, data []byte) {
+	b.varint(uint64(tag)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) message(tag int, encode func(*protoBuffer)) {
+	var msg protoBuffer
+	encode(&msg)
+	b.bytes(tag, msg.data)
+}
+
+func (b *protoBuffer) packed(tag int, xs []uint64) {
+	var msg protoBuffer
+	for _, x := range xs {
+		msg.varint(x)
+	}
+	b.bytes(tag, msg.data)
+}
+
+// WriteProfile 将统计以gzip压缩的pprof格式写入给定的writer，可以用 "go tool pprof" 查看或生成火焰图。
+//
+// 每个样本是一个调用栈，最内层是执行的指令，外层依次是各调用帧中的调用指令。
+// 样本值为执行次数(steps)和消耗的gas，函数名由代码哈希和操作码组成，行号为PC
+func (p *GasProfiler) WriteProfile(writer io.Writer) error {
+	var (
+		table     = []string{""}
+		stringIDs = map[string]int64{"": 0}
+	)
+	str := func(s string) int64 {
+		if id, ok := stringIDs[s]; ok {
+			return id
+		}
+		stringIDs[s] = int64(len(table))
+		table = append(table, s)
+		return stringIDs[s]
+	}
+	type function struct {
+		id       uint64
+		name     int64
+		filename int64
+	}
+	var (
+		functions   []*function
+		functionIDs = make(map[string]*function)
+		locations   = make(map[profileKey]uint64)
+		locationFns []uint64
+		locationPcs []uint64
+	)
+	location := func(key profileKey) uint64 {
+		if id, ok := locations[key]; ok {
+			return id
+		}
+		var op OpCode
+		if entry := p.entries[key]; entry != nil {
+			op = entry.Op
+		}
+		name := fmt.Sprintf("%s %v", key.codeHash.TerminalString(), op)
+		fn := functionIDs[name]
+		if fn == nil {
+			fn = &function{id: uint64(len(functions) + 1), name: str(name), filename: str(key.codeHash.Hex())}
+			functions = append(functions, fn)
+			functionIDs[name] = fn
+		}
+		id := uint64(len(locationFns) + 1)
+		locations[key] = id
+		locationFns = append(locationFns, fn.id)
+		locationPcs = append(locationPcs, key.pc)
+		return id
+	}
+
+	// 按固定顺序输出样本，保证相同的执行得到相同的文件
+	ids := make([]string, 0, len(p.samples))
+	for id := range p.samples {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var buf protoBuffer
+	for _, typ := range [][2]string{{"steps", "count"}, {"gas", "gas"}} {
+		name, unit := str(typ[0]), str(typ[1])
+		buf.message(pbProfileSampleType, func(b *protoBuffer) {
+			b.int64(pbValueTypeType, name)
+			b.int64(pbValueTypeUnit, unit)
+		})
+	}
+	for _, id := range ids {
+		sample := p.samples[id]
+		stack := make([]uint64, len(sample.stack))
+		for i, key := range sample.stack {
+			stack[i] = location(key)
+		}
+		buf.message(pbProfileSample, func(b *protoBuffer) {
+			b.packed(pbSampleLocationID, stack)
+			b.packed(pbSampleValue, []uint64{uint64(sample.count), uint64(sample.gas)})
+		})
+	}
+	for i, fn := range locationFns {
+		pc := locationPcs[i]
+		buf.message(pbProfileLocation, func(b *protoBuffer) {
+			b.uint64(pbLocationID, uint64(i+1))
+			b.uint64(pbLocationAddress, pc)
+			b.message(pbLocationLine, func(b *protoBuffer) {
+				b.uint64(pbLineFunctionID, fn)
+				b.int64(pbLineLine, int64(pc))
+			})
+		})
+	}
+	for _, fn := range functions {
+		buf.message(pbProfileFunction, func(b *protoBuffer) {
+			b.uint64(pbFunctionID, fn.id)
+			b.int64(pbFunctionName, fn.name)
+			b.int64(pbFunctionSystemName, fn.name)
+			b.int64(pbFunctionFilename, fn.filename)
+		})
+	}
+	gasType, gasUnit := str("gas"), str("gas")
+	for _, s := range table {
+		buf.bytes(pbProfileStringTable, []byte(s))
+	}
+	buf.message(pbProfilePeriodType, func(b *protoBuffer) {
+		b.int64(pbValueTypeType, gasType)
+		b.int64(pbValueTypeUnit, gasUnit)
+	})
+	buf.int64(pbProfilePeriod, 1)
+
+	zw := gzip.NewWriter(writer)
+	if _, err := zw.Write(buf.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
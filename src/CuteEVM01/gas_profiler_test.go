@@ -0,0 +1,198 @@
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math/big"
+	"testing"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/crypto"
+	"CuteEVM01/Out/params"
+)
+
+func TestGasProfiler(t *testing.T) {
+	var (
+		caller = common.BytesToAddress([]byte("caller"))
+		callee = common.BytesToAddress([]byte("callee"))
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	// add(1, 2)
+	calleeCode := []byte{byte(PUSH1), 1, byte(PUSH1), 2, byte(ADD), byte(STOP)}
+	statedb.SetCode(callee, calleeCode)
+	// mstore(0, 1); staticcall(gas, 0x04, 0, 32, 0, 0); call(gas, callee, 0, 0, 0, 0, 0)
+	code := []byte{
+		byte(PUSH1), 1, byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 4, byte(GAS), byte(STATICCALL), byte(POP),
+		byte(PUSH1), 0, byte(DUP1), byte(DUP1), byte(DUP1), byte(DUP1), byte(PUSH32),
+	}
+	code = append(code, common.LeftPadBytes(callee.Bytes(), 32)...)
+	code = append(code, byte(GAS), byte(CALL), byte(POP), byte(STOP))
+	statedb.SetCode(caller, code)
+
+	profiler := NewGasProfiler()
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: profiler})
+	_, leftOverGas, err := vmenv.Call(AccountRef(common.Address{}), caller, nil, 1000000, new(big.Int))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	var (
+		total    uint64
+		entries  = profiler.Entries()
+		codeHash = crypto.Keccak256Hash(code)
+	)
+	for i, entry := range entries {
+		if i > 0 && entry.TotalGas() > entries[i-1].TotalGas() {
+			t.Errorf("entries not sorted by cost at %d", i)
+		}
+		total += entry.TotalGas()
+	}
+	// 所有指令的gas之和应等于实际消耗的gas
+	if used := 1000000 - leftOverGas; total != used {
+		t.Errorf("total gas mismatch: have %d, want %d", total, used)
+	}
+	var staticCall, call *GasProfileEntry
+	for _, entry := range entries {
+		if entry.CodeHash != codeHash {
+			continue
+		}
+		switch entry.Op {
+		case MSTORE:
+			if entry.ConstantGas+entry.DynamicGas != GasFastestStep || entry.MemoryGas != 3 {
+				t.Errorf("MSTORE mismatch: %+v", entry)
+			}
+		case STATICCALL:
+			staticCall = entry
+		case CALL:
+			call = entry
+		}
+	}
+	// 两次调用访问的都是冷地址，预编译合约的执行gas计入调用指令，而转给子调用的gas不计入
+	if staticCall == nil || call == nil {
+		t.Fatal("missing call entries")
+	}
+	if have, want := staticCall.DynamicGas-call.DynamicGas, params.IdentityBaseGas+params.IdentityPerWordGas; have != want {
+		t.Errorf("precompile gas mismatch: have %d, want %d", have, want)
+	}
+	contracts := profiler.Contracts()
+	if len(contracts) != 2 || contracts[0].CodeHash != codeHash {
+		t.Fatalf("unexpected contract profiles: %+v", contracts)
+	}
+	if have, want := contracts[1].Count, uint64(4); have != want {
+		t.Errorf("callee step count mismatch: have %d, want %d", have, want)
+	}
+
+	var buf bytes.Buffer
+	if err := profiler.WriteProfile(&buf); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %v", err)
+	}
+	if blob, err := ioutil.ReadAll(zr); err != nil || !bytes.Contains(blob, []byte(codeHash.Hex())) {
+		t.Errorf("unexpected profile content: %v", err)
+	}
+}
+
+func TestGasProfilerCreate(t *testing.T) {
+	// 初始化代码返回4字节的合约代码: mstore(0, 0x60016002); return(28, 4)
+	initCode := []byte{byte(PUSH4), 0x60, 0x01, 0x60, 0x02, byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 4, byte(PUSH1), 28, byte(RETURN)}
+	// mstore(0, initCode); create(0, 19, 13)
+	creator := append([]byte{byte(PUSH13)}, initCode...)
+	creator = append(creator, byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 13, byte(PUSH1), 19, byte(PUSH1), 0, byte(CREATE), byte(POP), byte(STOP))
+
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	for _, nested := range []bool{false, true} {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		profiler := NewGasProfiler()
+		vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: profiler})
+
+		var (
+			leftOverGas uint64
+			err         error
+		)
+		if nested {
+			address := common.BytesToAddress([]byte("creator"))
+			statedb.SetCode(address, creator)
+			_, leftOverGas, err = vmenv.Call(AccountRef(common.Address{}), address, nil, 1000000, new(big.Int))
+		} else {
+			_, _, leftOverGas, err = vmenv.Create(AccountRef(common.Address{}), initCode, 1000000, new(big.Int))
+		}
+		if err != nil {
+			t.Fatalf("nested %v: execution failed: %v", nested, err)
+		}
+		var total, deposit uint64
+		for _, entry := range profiler.Entries() {
+			total += entry.TotalGas()
+			if entry.Op == RETURN {
+				deposit = entry.DynamicGas
+			}
+		}
+		// 代码存储gas计入初始化代码的RETURN指令
+		if want := 4 * params.CreateDataGas; deposit != want {
+			t.Errorf("nested %v: deposit gas mismatch: have %d, want %d", nested, deposit, want)
+		}
+		if used := 1000000 - leftOverGas; total != used {
+			t.Errorf("nested %v: total gas mismatch: have %d, want %d", nested, total, used)
+		}
+	}
+}
+
+func TestGasProfilerValueCall(t *testing.T) {
+	var (
+		caller = common.BytesToAddress([]byte("caller"))
+		callee = common.BytesToAddress([]byte("callee"))
+	)
+	// call(gas, callee, 1, 0, 0, 0, 0)
+	code := []byte{byte(PUSH1), 0, byte(DUP1), byte(DUP1), byte(DUP1), byte(PUSH1), 1, byte(PUSH32)}
+	code = append(code, common.LeftPadBytes(callee.Bytes(), 32)...)
+	code = append(code, byte(GAS), byte(CALL), byte(POP), byte(STOP))
+
+	vmctx := Context{
+		CanTransfer: func(db StateDB, addr common.Address, amount *big.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		},
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	// 调用者余额为0时转账调用在进入子调用之前失败
+	for _, balance := range []int64{0, 1} {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		statedb.SetCode(callee, []byte{byte(PUSH1), 1, byte(POP), byte(STOP)})
+		statedb.SetCode(caller, code)
+		statedb.SetBalance(caller, big.NewInt(balance))
+
+		profiler := NewGasProfiler()
+		vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: profiler})
+		_, leftOverGas, err := vmenv.Call(AccountRef(common.Address{}), caller, nil, 1000000, new(big.Int))
+		if err != nil {
+			t.Fatalf("balance %d: call failed: %v", balance, err)
+		}
+		var total uint64
+		for _, entry := range profiler.Entries() {
+			total += entry.TotalGas()
+			// 冷地址访问加上转账的gas，未用掉的转出gas和津贴都返还给了调用者
+			if entry.Op == CALL {
+				if want := params.ColdAccountAccessCostEIP2929 + params.CallValueTransferGas - params.CallStipend; entry.DynamicGas != want {
+					t.Errorf("balance %d: call gas mismatch: have %d, want %d", balance, entry.DynamicGas, want)
+				}
+			}
+		}
+		if used := 1000000 - leftOverGas; total != used {
+			t.Errorf("balance %d: total gas mismatch: have %d, want %d", balance, total, used)
+		}
+	}
+}
@@ -16,7 +16,16 @@
 
 package vm
 
-import "testing"
+import (
+	"math/big"
+	"testing"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/hexutil"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/params"
+)
 
 func TestMemoryGasCost(t *testing.T) {
 	tests := []struct {
@@ -37,3 +46,164 @@ func TestMemoryGasCost(t *testing.T) {
 		}
 	}
 }
+
+var eip2200Tests = []struct {
+	original byte
+	gaspool  uint64
+	input    string
+	used     uint64
+	refund   uint64
+	failure  error
+}{
+	{0, math32, "0x60006000556000600055", 1612, 0, nil},                // 0 -> 0 -> 0
+	{0, math32, "0x60006000556001600055", 20812, 0, nil},               // 0 -> 0 -> 1
+	{0, math32, "0x60016000556000600055", 20812, 19200, nil},           // 0 -> 1 -> 0
+	{0, math32, "0x60016000556002600055", 20812, 0, nil},               // 0 -> 1 -> 2
+	{0, math32, "0x60016000556001600055", 20812, 0, nil},               // 0 -> 1 -> 1
+	{1, math32, "0x60006000556000600055", 5812, 15000, nil},            // 1 -> 0 -> 0
+	{1, math32, "0x60006000556001600055", 5812, 4200, nil},             // 1 -> 0 -> 1
+	{1, math32, "0x60006000556002600055", 5812, 0, nil},                // 1 -> 0 -> 2
+	{1, math32, "0x60026000556000600055", 5812, 15000, nil},            // 1 -> 2 -> 0
+	{1, math32, "0x60026000556003600055", 5812, 0, nil},                // 1 -> 2 -> 3
+	{1, math32, "0x60026000556001600055", 5812, 4200, nil},             // 1 -> 2 -> 1
+	{1, math32, "0x60026000556002600055", 5812, 0, nil},                // 1 -> 2 -> 2
+	{1, math32, "0x60016000556000600055", 5812, 15000, nil},            // 1 -> 1 -> 0
+	{1, math32, "0x60016000556002600055", 5812, 0, nil},                // 1 -> 1 -> 2
+	{1, math32, "0x60016000556001600055", 1612, 0, nil},                // 1 -> 1 -> 1
+	{0, math32, "0x600160005560006000556001600055", 40818, 19200, nil}, // 0 -> 1 -> 0 -> 1
+	{1, math32, "0x600060005560016000556000600055", 10818, 19200, nil}, // 1 -> 0 -> 1 -> 0
+	{1, 2306, "0x6001600055", 2306, 0, ErrOutOfGas},                    // 1 -> 1 (2300 sentry + 2xPUSH)
+	{1, 2307, "0x6001600055", 806, 0, nil},                             // 1 -> 1 (2301 sentry + 2xPUSH)
+}
+
+const math32 = 1 << 32
+
+// istanbulConfig enables every fork up to and including Istanbul.
+var istanbulConfig = func() *params.ChainConfig {
+	config := *params.AllEthashProtocolChanges
+	config.BerlinBlock = nil
+	config.LondonBlock = nil
+	config.ShanghaiBlock = nil
+	config.CancunBlock = nil
+	return &config
+}()
+
+func TestEIP2200(t *testing.T) {
+	for i, tt := range eip2200Tests {
+		address := common.BytesToAddress([]byte("contract"))
+
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		statedb.CreateAccount(address)
+		statedb.SetCode(address, hexutil.MustDecode(tt.input))
+		statedb.SetState(address, common.Hash{}, common.BytesToHash([]byte{tt.original}))
+		statedb.Finalise(true) // Push the state into the "original" slot
+
+		vmctx := Context{
+			CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+			Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+			BlockNumber: new(big.Int),
+		}
+		vmenv := NewEVM(vmctx, statedb, istanbulConfig, Config{})
+
+		_, gas, err := vmenv.Call(AccountRef(common.Address{}), address, nil, tt.gaspool, new(big.Int))
+		if err != tt.failure {
+			t.Errorf("test %d: failure mismatch: have %v, want %v", i, err, tt.failure)
+		}
+		if used := tt.gaspool - gas; used != tt.used {
+			t.Errorf("test %d: gas used mismatch: have %v, want %v", i, used, tt.used)
+		}
+		if refund := vmenv.StateDB.GetRefund(); refund != tt.refund {
+			t.Errorf("test %d: gas refund mismatch: have %v, want %v", i, refund, tt.refund)
+		}
+	}
+}
+
+var eip2929Tests = []struct {
+	input string
+	used  uint64
+}{
+	// sload(0), sload(0): cold then warm slot
+	{"0x6000546000545050", 3 + 2100 + 3 + 100 + 2 + 2},
+	// balance(0xff), balance(0xff): cold then warm account
+	{"0x60ff3160ff315050", 3 + 2600 + 3 + 100 + 2 + 2},
+	// balance(address(this)): the callee is warm from the start
+	{"0x3031", 2 + 100},
+	// extcodesize(0x01): precompiles are warm from the start
+	{"0x60013b", 3 + 100},
+	// sstore(0, 1) on a cold slot
+	{"0x6001600055", 3 + 3 + 2100 + 20000},
+}
+
+func TestEIP2929(t *testing.T) {
+	for i, tt := range eip2929Tests {
+		var (
+			caller  = common.BytesToAddress([]byte("caller"))
+			address = common.BytesToAddress([]byte("contract"))
+		)
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+		statedb.CreateAccount(address)
+		statedb.SetCode(address, hexutil.MustDecode(tt.input))
+		statedb.Finalise(true)
+
+		vmctx := Context{
+			CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+			Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+			BlockNumber: new(big.Int),
+		}
+		vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{})
+		statedb.PrepareAccessList(caller, &address, ActivePrecompiles(vmenv.chainRules))
+
+		_, gas, err := vmenv.Call(AccountRef(caller), address, nil, math32, new(big.Int))
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+		}
+		if used := math32 - gas; used != tt.used {
+			t.Errorf("test %d: gas used mismatch: have %v, want %v", i, used, tt.used)
+		}
+	}
+}
+
+func TestEIP3529(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.CreateAccount(address)
+	// sstore(0, 0) on an originally non-zero slot
+	statedb.SetCode(address, hexutil.MustDecode("0x6000600055"))
+	statedb.SetState(address, common.Hash{}, common.BytesToHash([]byte{1}))
+	statedb.Finalise(true)
+
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{})
+	statedb.PrepareAccessList(common.Address{}, &address, nil)
+
+	if _, _, err := vmenv.Call(AccountRef(common.Address{}), address, nil, math32, new(big.Int)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have, want := statedb.GetRefund(), params.SstoreClearsScheduleRefundEIP3529; have != want {
+		t.Errorf("gas refund mismatch: have %v, want %v", have, want)
+	}
+}
+
+func TestAccessListRevert(t *testing.T) {
+	var (
+		address = common.BytesToAddress([]byte("contract"))
+		slot    = common.BytesToHash([]byte{1})
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.PrepareAccessList(common.Address{}, nil, nil)
+
+	snapshot := statedb.Snapshot()
+	statedb.AddSlotToAccessList(address, slot)
+	if addrOk, slotOk := statedb.SlotInAccessList(address, slot); !addrOk || !slotOk {
+		t.Fatalf("slot missing from access list: address %v, slot %v", addrOk, slotOk)
+	}
+	statedb.RevertToSnapshot(snapshot)
+	if addrOk, slotOk := statedb.SlotInAccessList(address, slot); addrOk || slotOk {
+		t.Fatalf("access list not reverted: address %v, slot %v", addrOk, slotOk)
+	}
+}
@@ -399,6 +399,14 @@ func opBalance(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memo
 	return nil, nil
 }
 
+// opSelfBalance implements SELFBALANCE (EIP-1884), pushing the balance of the
+// executing contract without the cost of a BALANCE lookup.
+func opSelfBalance(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	balance := interpreter.intPool.get().Set(interpreter.evm.StateDB.GetBalance(contract.Address()))
+	stack.push(balance)
+	return nil, nil
+}
+
 func opOrigin(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 	stack.push(interpreter.intPool.get().SetBytes(interpreter.evm.Origin.Bytes()))
 	return nil, nil
@@ -580,6 +588,24 @@ func opGasLimit(pc *uint64, interpreter *EVMInterpreter, contract *Contract, mem
 	return nil, nil
 }
 
+// opChainID implements CHAINID (EIP-1344), pushing the chain id of the current
+// chain configuration.
+func opChainID(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	chainId := interpreter.intPool.get().Set(interpreter.evm.chainConfig.ChainID)
+	stack.push(chainId)
+	return nil, nil
+}
+
+// opBaseFee implements BASEFEE (EIP-3198), pushing the base fee of the current block.
+func opBaseFee(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	baseFee := interpreter.intPool.getZero()
+	if interpreter.evm.BaseFee != nil {
+		baseFee.Set(interpreter.evm.BaseFee)
+	}
+	stack.push(baseFee)
+	return nil, nil
+}
+
 func opPop(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 	interpreter.intPool.put(stack.pop())
 	return nil, nil
@@ -626,6 +652,40 @@ func opSstore(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memor
 	return nil, nil
 }
 
+// opTload implements TLOAD (EIP-1153), reading a word from the transient
+// storage of the executing contract.
+func opTload(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	loc := stack.peek()
+	val := interpreter.evm.StateDB.GetTransientState(contract.Address(), common.BigToHash(loc))
+	loc.SetBytes(val.Bytes())
+	return nil, nil
+}
+
+// opTstore implements TSTORE (EIP-1153), writing a word to the transient
+// storage of the executing contract.
+func opTstore(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	loc := common.BigToHash(stack.pop())
+	val := stack.pop()
+	interpreter.evm.StateDB.SetTransientState(contract.Address(), loc, common.BigToHash(val))
+
+	interpreter.intPool.put(val)
+	return nil, nil
+}
+
+// opMcopy implements MCOPY (EIP-5656), copying memory areas which may overlap.
+// The memory has already been expanded to cover both areas.
+func opMcopy(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	var (
+		dst    = stack.pop()
+		src    = stack.pop()
+		length = stack.pop()
+	)
+	memory.Set(dst.Uint64(), length.Uint64(), memory.GetPtr(src.Int64(), length.Int64()))
+
+	interpreter.intPool.put(dst, src, length)
+	return nil, nil
+}
+
 func opJump(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 	pos := stack.pop()
 	if !contract.validJumpdest(pos) {
@@ -909,6 +969,12 @@ func opPush1(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory
 	return nil, nil
 }
 
+// opPush0 implements PUSH0 (EIP-3855), pushing the constant zero.
+func opPush0(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	stack.push(interpreter.intPool.getZero())
+	return nil, nil
+}
+
 // make push instruction function
 func makePush(size uint64, pushByteSize int) executionFunc {
 	return func(pc *uint64, interpreter *EVMInterpreter, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
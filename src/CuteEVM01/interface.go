@@ -46,6 +46,20 @@ type 	StateDB interface {
 	AddPreimage(common.Hash, []byte)
 
 	ForEachStorage(common.Address, func(common.Hash, common.Hash) bool) error
+
+	// EIP-2929 访问列表: 记录当前交易中已访问(warm)的地址和存储槽，其修改同样会在回滚快照时撤销
+	PrepareAccessList(sender common.Address, dest *common.Address, precompiles []common.Address)
+	AddressInAccessList(addr common.Address) bool
+	SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool)
+	// AddAddressToAccessList 将给定地址加入访问列表，即使已经存在也可以安全调用
+	AddAddressToAccessList(addr common.Address)
+	// AddSlotToAccessList 将给定的(地址, 存储槽)加入访问列表，即使已经存在也可以安全调用
+	AddSlotToAccessList(addr common.Address, slot common.Hash)
+
+	// EIP-1153 临时存储: 修改同样记入日志，并在每次顶层执行结束时清空
+	GetTransientState(addr common.Address, key common.Hash) common.Hash
+	SetTransientState(addr common.Address, key, value common.Hash)
+	ClearTransientStorage()
 }
 
 // CallContext为EVM调用合约提供了一个基本接口。EVM依赖于为执行子调用和初始化新的EVM合约而实现的上下文。
@@ -6,6 +6,7 @@ import (
 	"hash"
 	"sync/atomic"
 
+	"CuteEVM01/Out/accounts/abi"
 	"CuteEVM01/Out/common"
 	"CuteEVM01/Out/common/math"
 	"CuteEVM01/Out/params"
@@ -20,8 +21,14 @@ type Config struct {
 
 	JumpTable [256]operation // EVM指令表，如果未设置，将自动填充
 
-	EWASMInterpreter string // 外部EWASM解释器选项
-	EVMInterpreter   string // 外部EVM解释器选项
+	// Precompiles 覆盖当前分叉默认的预编译合约: 新地址注册自定义的原生合约，
+	// 已有地址替换内置合约，值为nil则禁用该地址的内置合约。gas仍按合约的 RequiredGas 计费
+	Precompiles map[common.Address]PrecompiledContract
+
+	EWASMInterpreter string // 外部EWASM解释器选项，格式为 "名称[:选项...]"，名称须已通过 RegisterInterpreter 注册
+	EVMInterpreter   string // 外部EVM解释器选项，格式同上。内置的EVM解释器总是作为故障转移选项
+
+	ErrorABI *abi.ABI // 用于解码顶层调用回滚时返回的自定义错误，可以为nil
 }
 
 // 解释器用于运行基于Ethereum的合约，并将使用传递的环境查询外部源以获取状态信息。
@@ -68,6 +75,16 @@ func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
 	//我们使用STOP指令查看是否初始化了跳转表。如果不是，我们将设置默认跳转表。
 	if !cfg.JumpTable[STOP].valid {
 		switch {
+		case evm.ChainConfig().IsCancun(evm.BlockNumber):
+			cfg.JumpTable = cancunInstructionSet
+		case evm.ChainConfig().IsShanghai(evm.BlockNumber):
+			cfg.JumpTable = shanghaiInstructionSet
+		case evm.ChainConfig().IsLondon(evm.BlockNumber):
+			cfg.JumpTable = londonInstructionSet
+		case evm.ChainConfig().IsBerlin(evm.BlockNumber):
+			cfg.JumpTable = berlinInstructionSet
+		case evm.ChainConfig().IsIstanbul(evm.BlockNumber):
+			cfg.JumpTable = istanbulInstructionSet
 		case evm.ChainConfig().IsConstantinople(evm.BlockNumber):
 			cfg.JumpTable = constantinopleInstructionSet
 		case evm.ChainConfig().IsByzantium(evm.BlockNumber):
@@ -99,11 +116,6 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		}()
 	}
 
-	// Increment the call depth which is restricted to 1024
-	//增加调用深度（原调用深度被限制为1024）
-	in.evm.depth++
-	defer func() { in.evm.depth-- }()
-
 	// 确保只有在还没有设置readOnly时才设置readOnly.
 	// 这也确保了没有为子调用删除readOnly标志。
 	if readOnly && !in.readOnly {
@@ -156,8 +168,8 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	// 或者在执行某个操作时发生错误，或者直到父上下文设置done标志。
 	for atomic.LoadInt32(&in.evm.abort) == 0 {
 		if in.cfg.Debug {
-			// 捕获用于跟踪的执行前值。
-			logged, pcCopy, gasCopy = false, pc, contract.Gas
+			// 捕获用于跟踪的执行前值。没有动态gas的指令的 cost 为0，而不是上一条指令的值
+			logged, pcCopy, gasCopy, cost = false, pc, contract.Gas, 0
 		}
 
 		//从跳转表获取操作并验证堆栈，以确保有足够的堆栈空间可用来执行该操作。
@@ -239,7 +251,8 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 			pc++
 		}
 	}
-	return nil, nil
+	// 只有通过 EVM.Cancel 中止时才会离开循环
+	return nil, ErrExecutionAborted
 }
 
 // CanRun告诉作为参数传递的合约是否可以由当前解释器运行。
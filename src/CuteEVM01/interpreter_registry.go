@@ -0,0 +1,68 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// InterpreterFactory 为给定的EVM创建一个解释器。
+// options 是配置字符串中名称之后以冒号分隔的参数，例如 "wasmer:/path/to/lib:debug" 得到 ["/path/to/lib", "debug"]
+type InterpreterFactory func(evm *EVM, cfg Config, options []string) (Interpreter, error)
+
+var (
+	interpretersMu       sync.RWMutex
+	interpreterFactories = make(map[string]InterpreterFactory)
+)
+
+// RegisterInterpreter 以给定名称注册一个解释器实现，之后可以通过 Config.EWASMInterpreter
+// 或 Config.EVMInterpreter 选用。通常在实现解释器的包的init函数中调用，
+// 名称为空、factory为nil或名称重复注册时会panic
+func RegisterInterpreter(name string, factory InterpreterFactory) {
+	if name == "" || strings.Contains(name, ":") {
+		panic(fmt.Sprintf("vm: invalid interpreter name %q", name))
+	}
+	if factory == nil {
+		panic("vm: RegisterInterpreter factory is nil")
+	}
+	interpretersMu.Lock()
+	defer interpretersMu.Unlock()
+
+	if _, dup := interpreterFactories[name]; dup {
+		panic(fmt.Sprintf("vm: RegisterInterpreter called twice for interpreter %q", name))
+	}
+	interpreterFactories[name] = factory
+}
+
+// Interpreters 返回所有已注册解释器的名称(按字母排序)
+func Interpreters() []string {
+	interpretersMu.RLock()
+	defer interpretersMu.RUnlock()
+
+	names := make([]string, 0, len(interpreterFactories))
+	for name := range interpreterFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newInterpreter 解析 "名称[:选项...]" 形式的配置字符串，并用注册的工厂创建解释器
+func newInterpreter(evm *EVM, cfg Config, spec string) (Interpreter, error) {
+	parts := strings.Split(spec, ":")
+	name, options := parts[0], parts[1:]
+
+	interpretersMu.RLock()
+	factory, ok := interpreterFactories[name]
+	interpretersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown interpreter %q, registered: %s", name, strings.Join(Interpreters(), ", "))
+	}
+	interpreter, err := factory(evm, cfg, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create interpreter %q: %v", name, err)
+	}
+	return interpreter, nil
+}
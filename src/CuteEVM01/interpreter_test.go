@@ -0,0 +1,100 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/params"
+)
+
+// wasmMagic 是WebAssembly模块的前缀
+var wasmMagic = []byte("\x00asm")
+
+// testWasmInterpreter 是只用于测试的解释器，它能"执行"所有以wasm魔数开头的代码，
+// 返回创建时的选项以及当前的调用深度
+type testWasmInterpreter struct {
+	evm     *EVM
+	options []string
+}
+
+func (in *testWasmInterpreter) Run(contract *Contract, input []byte, static bool) ([]byte, error) {
+	return []byte(fmt.Sprintf("%s:%d", strings.Join(in.options, ","), in.evm.depth)), nil
+}
+
+func (in *testWasmInterpreter) CanRun(code []byte) bool {
+	return bytes.HasPrefix(code, wasmMagic)
+}
+
+func init() {
+	RegisterInterpreter("testwasm", func(evm *EVM, cfg Config, options []string) (Interpreter, error) {
+		return &testWasmInterpreter{evm: evm, options: options}, nil
+	})
+}
+
+func TestInterpreterDispatch(t *testing.T) {
+	var (
+		wasmAddr = common.BytesToAddress([]byte("wasm"))
+		evmAddr  = common.BytesToAddress([]byte("evm"))
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetCode(wasmAddr, append(wasmMagic, 0x01, 0x00, 0x00, 0x00))
+	// mstore8(0, 0x2a); return(0, 1)
+	statedb.SetCode(evmAddr, []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0, byte(MSTORE8), byte(PUSH1), 1, byte(PUSH1), 0, byte(RETURN)})
+
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{EWASMInterpreter: "testwasm:foo:bar"})
+
+	ret, _, err := vmenv.Call(AccountRef(common.Address{}), wasmAddr, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("wasm call failed: %v", err)
+	}
+	if have, want := string(ret), "foo,bar:1"; have != want {
+		t.Errorf("wasm result mismatch: have %q, want %q", have, want)
+	}
+	// 其他代码仍由内置的EVM解释器执行
+	ret, _, err = vmenv.Call(AccountRef(common.Address{}), evmAddr, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("evm call failed: %v", err)
+	}
+	if !bytes.Equal(ret, []byte{0x2a}) {
+		t.Errorf("evm result mismatch: have %x, want 2a", ret)
+	}
+}
+
+func TestUnknownInterpreter(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	vmenv := NewEVM(Context{BlockNumber: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{EVMInterpreter: "nonexistent"})
+	if err := vmenv.Err(); err == nil || !strings.Contains(err.Error(), "unknown interpreter \"nonexistent\"") {
+		t.Fatalf("unexpected configuration error: %v", err)
+	}
+	// 配置错误的EVM不执行任何代码
+	if _, gas, err := vmenv.Call(AccountRef(common.Address{}), common.Address{}, nil, 100, new(big.Int)); err != vmenv.Err() || gas != 100 {
+		t.Errorf("call on misconfigured evm: gas %d, err %v", gas, err)
+	}
+	if _, _, gas, err := vmenv.Create(AccountRef(common.Address{}), nil, 100, new(big.Int)); err != vmenv.Err() || gas != 100 {
+		t.Errorf("create on misconfigured evm: gas %d, err %v", gas, err)
+	}
+}
+
+func TestMissingEWASMInterpreter(t *testing.T) {
+	config := *params.AllEthashProtocolChanges
+	config.EWASMBlock = big.NewInt(0)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	vmenv := NewEVM(Context{BlockNumber: new(big.Int)}, statedb, &config, Config{})
+	if err := vmenv.Err(); err != ErrNoEWASMInterpreter {
+		t.Fatalf("unexpected configuration error: %v", err)
+	}
+	if _, _, err := vmenv.StaticCall(AccountRef(common.Address{}), common.Address{}, nil, 100); err != ErrNoEWASMInterpreter {
+		t.Errorf("unexpected call error: %v", err)
+	}
+}
@@ -44,8 +44,119 @@ var (//该处定义四个指令集合对应EVM发展的四个阶段，指令集
 	homesteadInstructionSet      = newHomesteadInstructionSet()//256长度的数组homestead——庄园
 	byzantiumInstructionSet      = newByzantiumInstructionSet()//byzantium————拜占庭
 	constantinopleInstructionSet = newConstantinopleInstructionSet()//constantinople————君士坦丁堡（直译）
+	istanbulInstructionSet       = newIstanbulInstructionSet()       //istanbul————伊斯坦布尔
+	berlinInstructionSet         = newBerlinInstructionSet()         //berlin————柏林
+	londonInstructionSet         = newLondonInstructionSet()         //london————伦敦
+	shanghaiInstructionSet       = newShanghaiInstructionSet()       //shanghai————上海
+	cancunInstructionSet         = newCancunInstructionSet()         //cancun————坎昆
 )
 
+// newCancunInstructionSet 在上海阶段的基础上返回坎昆阶段的指令:
+// EIP-1153 临时存储TLOAD/TSTORE，以及EIP-5656 MCOPY
+func newCancunInstructionSet() [256]operation {
+	instructionSet := newShanghaiInstructionSet()
+	instructionSet[TLOAD] = operation{
+		execute:     opTload,
+		constantGas: params.WarmStorageReadCostEIP2929,
+		minStack:    minStack(1, 1),
+		maxStack:    maxStack(1, 1),
+		valid:       true,
+	}
+	instructionSet[TSTORE] = operation{
+		execute:     opTstore,
+		constantGas: params.WarmStorageReadCostEIP2929,
+		minStack:    minStack(2, 0),
+		maxStack:    maxStack(2, 0),
+		valid:       true,
+		writes:      true,
+	}
+	instructionSet[MCOPY] = operation{
+		execute:    opMcopy,
+		dynamicGas: gasMcopy,
+		minStack:   minStack(3, 0),
+		maxStack:   maxStack(3, 0),
+		memorySize: memoryMcopy,
+		valid:      true,
+	}
+	return instructionSet
+}
+
+// newShanghaiInstructionSet 在伦敦阶段的基础上返回上海阶段的指令:
+// EIP-3855 PUSH0，以及EIP-3860对CREATE/CREATE2初始化代码按字计费并限制其大小
+func newShanghaiInstructionSet() [256]operation {
+	instructionSet := newLondonInstructionSet()
+	instructionSet[PUSH0] = operation{
+		execute:     opPush0,
+		constantGas: GasQuickStep,
+		minStack:    minStack(0, 1),
+		maxStack:    maxStack(0, 1),
+		valid:       true,
+	}
+	instructionSet[CREATE].dynamicGas = gasCreateEip3860
+	instructionSet[CREATE2].dynamicGas = gasCreate2Eip3860
+	return instructionSet
+}
+
+// newLondonInstructionSet 在柏林阶段的基础上返回伦敦阶段的指令:
+// EIP-3198 BASEFEE，以及EIP-3529减少SSTORE清除存储槽的退款并取消SELFDESTRUCT的退款
+func newLondonInstructionSet() [256]operation {
+	instructionSet := newBerlinInstructionSet()
+	instructionSet[BASEFEE] = operation{
+		execute:     opBaseFee,
+		constantGas: GasQuickStep,
+		minStack:    minStack(0, 1),
+		maxStack:    maxStack(0, 1),
+		valid:       true,
+	}
+	instructionSet[SSTORE].dynamicGas = gasSStoreEIP3529
+	instructionSet[SELFDESTRUCT].dynamicGas = gasSuicideEIP3529
+	return instructionSet
+}
+
+// newBerlinInstructionSet 返回开拓、家园、拜占庭、君士坦丁堡、伊斯坦布尔和柏林阶段的指令。
+// EIP-2929: 访问账户和存储槽的指令按照访问列表区分冷(首次访问)/热访问计费，
+// 热访问的价格由 params.GasTableBerlin 给出
+func newBerlinInstructionSet() [256]operation {
+	instructionSet := newIstanbulInstructionSet()
+	instructionSet[SLOAD].dynamicGas = gasSLoadEIP2929
+	instructionSet[SSTORE].dynamicGas = gasSStoreEIP2929
+	instructionSet[EXTCODECOPY].dynamicGas = gasExtCodeCopyEIP2929
+	instructionSet[EXTCODESIZE].dynamicGas = gasAccountCheckEIP2929
+	instructionSet[EXTCODEHASH].dynamicGas = gasAccountCheckEIP2929
+	instructionSet[BALANCE].dynamicGas = gasAccountCheckEIP2929
+	instructionSet[CALL].dynamicGas = gasCallEIP2929
+	instructionSet[CALLCODE].dynamicGas = gasCallCodeEIP2929
+	instructionSet[STATICCALL].dynamicGas = gasStaticCallEIP2929
+	instructionSet[DELEGATECALL].dynamicGas = gasDelegateCallEIP2929
+	instructionSet[SELFDESTRUCT].dynamicGas = gasSuicideEIP2929
+	return instructionSet
+}
+
+// newIstanbulInstructionSet 返回开拓、家园、拜占庭、君士坦丁堡和伊斯坦布尔阶段的指令。
+// EIP-1884对SLOAD、BALANCE和EXTCODEHASH的重新定价通过 params.GasTableIstanbul 生效
+func newIstanbulInstructionSet() [256]operation {
+	instructionSet := newConstantinopleInstructionSet()
+	// EIP-1344: CHAINID
+	instructionSet[CHAINID] = operation{
+		execute:     opChainID,
+		constantGas: GasQuickStep,
+		minStack:    minStack(0, 1),
+		maxStack:    maxStack(0, 1),
+		valid:       true,
+	}
+	// EIP-1884: SELFBALANCE
+	instructionSet[SELFBALANCE] = operation{
+		execute:     opSelfBalance,
+		constantGas: GasFastStep,
+		minStack:    minStack(0, 1),
+		maxStack:    maxStack(0, 1),
+		valid:       true,
+	}
+	// EIP-2200: 带重入保护的净计量SSTORE
+	instructionSet[SSTORE].dynamicGas = gasSStoreEIP2200
+	return instructionSet
+}
+
 // NewConstantinopleInstructionSet函数 返回开拓、家园、拜占庭和君士坦丁堡
 
 func newConstantinopleInstructionSet() [256]operation {
@@ -78,7 +78,9 @@ func (s *StructLog) ErrorString() string {
 
 // Tracer is used to collect execution traces from an EVM transaction
 // execution. CaptureState is called for each step of the VM with the
-// current VM state.
+// current VM state. CaptureEnter and CaptureExit are called when a nested
+// call frame (CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE or CREATE2)
+// is entered and left, including calls to precompiled contracts.
 // Note that reference types are actual VM data structures; make copies
 // if you need to retain them beyond the current call.
 type Tracer interface {
@@ -86,6 +88,8 @@ type Tracer interface {
 	CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error
 	CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error
 	CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error
+	CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error
+	CaptureExit(output []byte, gasUsed uint64, err error) error
 }
 
 // StructLogger is an EVM state logger and implements Tracer.
@@ -187,6 +191,16 @@ func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration
 	return nil
 }
 
+// CaptureEnter is called when the EVM enters a new call frame.
+func (l *StructLogger) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit is called when the EVM leaves a call frame.
+func (l *StructLogger) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
 // StructLogs returns the captured log entries.
 func (l *StructLogger) StructLogs() []StructLog { return l.logs }
 
@@ -18,6 +18,7 @@ package vm
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"math/big"
 	"time"
@@ -72,16 +73,33 @@ func (l *JSONLogger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint
 	return nil
 }
 
-// CaptureEnd is triggered at end of execution.
+// CaptureEnd is triggered at end of execution. Decoded revert reasons are
+// reported in a dedicated revertReason field next to the error.
 func (l *JSONLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
 	type endLog struct {
-		Output  string              `json:"output"`
-		GasUsed math.HexOrDecimal64 `json:"gasUsed"`
-		Time    time.Duration       `json:"time"`
-		Err     string              `json:"error,omitempty"`
+		Output       string              `json:"output"`
+		GasUsed      math.HexOrDecimal64 `json:"gasUsed"`
+		Time         time.Duration       `json:"time"`
+		Err          string              `json:"error,omitempty"`
+		RevertReason string              `json:"revertReason,omitempty"`
 	}
+	log := endLog{Output: common.Bytes2Hex(output), GasUsed: math.HexOrDecimal64(gasUsed), Time: t}
 	if err != nil {
-		return l.encoder.Encode(endLog{common.Bytes2Hex(output), math.HexOrDecimal64(gasUsed), t, err.Error()})
+		log.Err = err.Error()
 	}
-	return l.encoder.Encode(endLog{common.Bytes2Hex(output), math.HexOrDecimal64(gasUsed), t, ""})
+	var revert *RevertError
+	if errors.As(err, &revert) {
+		log.RevertReason = revert.Reason()
+	}
+	return l.encoder.Encode(log)
+}
+
+// CaptureEnter is called when the EVM enters a new call frame.
+func (l *JSONLogger) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit is called when the EVM leaves a call frame.
+func (l *JSONLogger) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
 }
@@ -1,11 +1,14 @@
 package vm
 
 import (
+	"fmt"
 	"math/big"
 	"testing"
 
 	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
 	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/crypto"
 	"CuteEVM01/Out/params"
 )
 
@@ -52,3 +55,98 @@ func TestStoreCapture(t *testing.T) {
 		t.Errorf("expected %x, got %x", exp, logger.changedValues[contract.Address()][index])
 	}
 }
+
+// frameTracer 记录所有进入/退出调用帧的事件
+type frameTracer struct {
+	*StructLogger
+	events []string
+}
+
+func (t *frameTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	t.events = append(t.events, fmt.Sprintf("enter %v %x", typ, to))
+	return nil
+}
+
+func (t *frameTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	t.events = append(t.events, fmt.Sprintf("exit %d %v", gasUsed, err))
+	return nil
+}
+
+func TestCallFrameCapture(t *testing.T) {
+	var (
+		caller   = common.BytesToAddress([]byte("caller"))
+		callee   = common.BytesToAddress([]byte("callee"))
+		identity = common.BytesToAddress([]byte{4})
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetCode(callee, []byte{byte(STOP)})
+	// staticcall(gas, 0x04, 0, 0, 0, 0)
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 4, byte(GAS), byte(STATICCALL), byte(POP)}
+	// call(gas, callee, 0, 0, 0, 0, 0)
+	code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH32))
+	code = append(code, common.LeftPadBytes(callee.Bytes(), 32)...)
+	code = append(code, byte(GAS), byte(CALL), byte(POP))
+	// create(0, 0, 0)
+	code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(CREATE), byte(POP), byte(STOP))
+	statedb.SetCode(caller, code)
+
+	tracer := &frameTracer{StructLogger: NewStructLogger(nil)}
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: tracer})
+	if _, _, err := vmenv.Call(AccountRef(common.Address{}), caller, nil, 1000000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	created := crypto.CreateAddress(caller, 0)
+	want := []string{
+		fmt.Sprintf("enter STATICCALL %x", identity),
+		fmt.Sprintf("exit %d <nil>", params.IdentityBaseGas),
+		fmt.Sprintf("enter CALL %x", callee),
+		"exit 0 <nil>",
+		fmt.Sprintf("enter CREATE %x", created),
+		"exit 0 <nil>",
+	}
+	if len(tracer.events) != len(want) {
+		t.Fatalf("event count mismatch: have %v, want %v", tracer.events, want)
+	}
+	for i := range want {
+		if tracer.events[i] != want[i] {
+			t.Errorf("event %d mismatch: have %q, want %q", i, tracer.events[i], want[i])
+		}
+	}
+}
+
+// TestStructLogCost 检查没有动态gas的指令报告的 cost 为0，而不是沿用上一条指令的值
+func TestStructLogCost(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	address := common.BytesToAddress([]byte("contract"))
+	// mload(0); push1 0
+	statedb.SetCode(address, []byte{byte(PUSH1), 0, byte(MLOAD), byte(PUSH1), 0, byte(STOP)})
+
+	logger := NewStructLogger(nil)
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: logger})
+	if _, _, err := vmenv.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	logs := logger.StructLogs()
+	want := []struct {
+		op   OpCode
+		cost uint64
+	}{{PUSH1, 0}, {MLOAD, GasFastestStep + 3}, {PUSH1, 0}, {STOP, 0}}
+	if len(logs) != len(want) {
+		t.Fatalf("log count mismatch: have %d, want %d", len(logs), len(want))
+	}
+	for i, w := range want {
+		if logs[i].Op != w.op || logs[i].GasCost != w.cost {
+			t.Errorf("step %d mismatch: have %v cost %d, want %v cost %d", i, logs[i].Op, logs[i].GasCost, w.op, w.cost)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	vm "CuteEVM01"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/math"
+	"CuteEVM01/runtime"
+)
+
+const debugHelp = `Commands:
+  step, s                      执行一条指令，进入子调用
+  next, n                      执行一条指令，跳过子调用
+  continue, c                  继续执行直到下一个断点
+  break pc <pc> [address]      在给定PC处设置断点，可以限定代码地址
+  break op <opcode>            在给定操作码处设置断点
+  break address <address>      在进入给定地址的代码时暂停
+  break slot <slot> [address]  在SLOAD/SSTORE访问给定存储槽时暂停
+  delete <id>                  删除断点
+  breakpoints                  列出所有断点
+  where                        打印当前位置
+  stack                        打印栈
+  memory                       打印内存
+  storage <slot>               打印当前合约的存储槽
+  quit, q                      中止执行并退出`
+
+// debugCmd 实现 "cuteevm debug" 命令:
+// 与 run 命令使用相同的参数准备执行，但在交互式的调试器中逐条指令地执行
+func debugCmd(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	var (
+		runFlags  = addRunFlags(fs)
+		entryFlag = fs.Bool("stop-on-entry", true, "在第一条指令处暂停")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, receiver, input, err := runFlags.setup()
+	defer runFlags.close()
+	if err != nil {
+		return err
+	}
+
+	dbg := vm.NewDebugger(*entryFlag)
+	cfg.EVMConfig.Debug = true
+	cfg.EVMConfig.Tracer = dbg
+
+	var (
+		ret         []byte
+		leftOverGas uint64
+		callErr     error
+	)
+	dbg.Start(func() {
+		ret, leftOverGas, callErr = runtime.Call(receiver, input, cfg)
+	})
+	if err := debugLoop(dbg, os.Stdin, os.Stdout); err != nil {
+		return err
+	}
+	// 被中止的会话没有执行结果，也不提交状态
+	if errors.Is(callErr, vm.ErrExecutionAborted) {
+		return callErr
+	}
+	fmt.Printf("0x%x\n", ret)
+	fmt.Printf("gas used: %d\n", cfg.GasLimit-leftOverGas)
+	if callErr != nil {
+		fmt.Printf("error: %v\n", callErr)
+	}
+	return runFlags.finish(cfg)
+}
+
+// debugLoop 在每次暂停时读取并执行调试命令，直到执行结束
+func debugLoop(dbg *vm.Debugger, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for state, ok := dbg.Wait(); ok; state, ok = dbg.Wait() {
+		if state.Breakpoint != nil {
+			fmt.Fprintf(out, "breakpoint %v\n", state.Breakpoint)
+		}
+		printLocation(out, state)
+
+		for resumed := false; !resumed; {
+			fmt.Fprint(out, "(debug) ")
+			if !scanner.Scan() {
+				// 输入结束时中止执行，避免执行的goroutine一直阻塞
+				dbg.Abort()
+				break
+			}
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "step", "s":
+				dbg.Step()
+				resumed = true
+			case "next", "n":
+				dbg.StepOver()
+				resumed = true
+			case "continue", "c":
+				dbg.Continue()
+				resumed = true
+			case "quit", "q":
+				dbg.Abort()
+				resumed = true
+			case "break", "b":
+				bp, err := parseBreakpoint(fields[1:])
+				if err != nil {
+					fmt.Fprintln(out, err)
+					break
+				}
+				bp.ID = dbg.AddBreakpoint(bp)
+				fmt.Fprintf(out, "breakpoint %v set\n", bp)
+			case "delete", "d":
+				id, err := strconv.Atoi(strings.Join(fields[1:], ""))
+				if err != nil || !dbg.RemoveBreakpoint(id) {
+					fmt.Fprintln(out, "no such breakpoint")
+				}
+			case "breakpoints":
+				for _, bp := range dbg.Breakpoints() {
+					fmt.Fprintln(out, bp)
+				}
+			case "where":
+				printLocation(out, state)
+			case "stack":
+				for i := len(state.Stack) - 1; i >= 0; i-- {
+					fmt.Fprintf(out, "%04d: %#x\n", len(state.Stack)-1-i, state.Stack[i])
+				}
+			case "memory":
+				for i := 0; i+32 <= len(state.Memory); i += 32 {
+					fmt.Fprintf(out, "%04x: %x\n", i, state.Memory[i:i+32])
+				}
+			case "storage":
+				if len(fields) != 2 {
+					fmt.Fprintln(out, "usage: storage <slot>")
+					break
+				}
+				slot, err := parseSlot(fields[1])
+				if err != nil {
+					fmt.Fprintln(out, err)
+					break
+				}
+				fmt.Fprintf(out, "%x: %x\n", slot, state.Storage(slot))
+			case "help", "h":
+				fmt.Fprintln(out, debugHelp)
+			default:
+				fmt.Fprintf(out, "unknown command %q, type \"help\" for a list of commands\n", fields[0])
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// printLocation 打印暂停时即将执行的指令
+func printLocation(out io.Writer, state *vm.DebugState) {
+	fmt.Fprintf(out, "depth %d %x pc %d: %v gas %d cost %d\n", state.Depth, state.CodeAddress, state.Pc, state.Op, state.Gas, state.Cost)
+}
+
+// parseBreakpoint 解析 break 命令的参数
+func parseBreakpoint(args []string) (vm.Breakpoint, error) {
+	var bp vm.Breakpoint
+	if len(args) < 2 {
+		return bp, errors.New("usage: break pc|op|address|slot <value> [address]")
+	}
+	switch args[0] {
+	case "pc":
+		pc, ok := math.ParseUint64(args[1])
+		if !ok {
+			return bp, fmt.Errorf("invalid pc %q", args[1])
+		}
+		bp.Kind, bp.Pc = vm.BreakPC, pc
+	case "op":
+		name := strings.ToUpper(args[1])
+		op := vm.StringToOp(name)
+		if op == vm.STOP && name != "STOP" {
+			return bp, fmt.Errorf("unknown opcode %q", args[1])
+		}
+		bp.Kind, bp.Op = vm.BreakOp, op
+		return bp, nil
+	case "address":
+		if !common.IsHexAddress(args[1]) {
+			return bp, fmt.Errorf("invalid address %q", args[1])
+		}
+		bp.Kind, bp.Address = vm.BreakAddress, common.HexToAddress(args[1])
+		return bp, nil
+	case "slot":
+		slot, err := parseSlot(args[1])
+		if err != nil {
+			return bp, err
+		}
+		bp.Kind, bp.Slot = vm.BreakStorage, slot
+	default:
+		return bp, fmt.Errorf("unknown breakpoint kind %q", args[0])
+	}
+	// pc 与 slot 断点可以限定地址
+	if len(args) > 2 {
+		if !common.IsHexAddress(args[2]) {
+			return bp, fmt.Errorf("invalid address %q", args[2])
+		}
+		bp.Address = common.HexToAddress(args[2])
+	}
+	return bp, nil
+}
+
+// parseSlot 解析十进制或0x开头的十六进制存储槽
+func parseSlot(s string) (common.Hash, error) {
+	slot, ok := math.ParseBig256(s)
+	if !ok {
+		return common.Hash{}, fmt.Errorf("invalid slot %q", s)
+	}
+	return common.BigToHash(slot), nil
+}
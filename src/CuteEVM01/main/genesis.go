@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/math"
+	"CuteEVM01/Out/params"
+	"CuteEVM01/runtime"
+)
+
+// genesis 是 --prestate 读取的genesis格式的JSON文件，
+// 除账户分配(alloc)外，还可以给出链配置和区块环境
+type genesis struct {
+	Config     *params.ChainConfig   `json:"config"`
+	Coinbase   common.Address        `json:"coinbase"`
+	Timestamp  math.HexOrDecimal64   `json:"timestamp"`
+	Number     math.HexOrDecimal64   `json:"number"`
+	Difficulty *math.HexOrDecimal256 `json:"difficulty"`
+	BaseFee    *math.HexOrDecimal256 `json:"baseFeePerGas"`
+	Alloc      runtime.GenesisAlloc  `json:"alloc"`
+}
+
+// readGenesis 从给定的文件中读取genesis。文件也可以只包含alloc本身
+// (例如 --poststate 写出的文件)，此时链配置与区块环境使用默认值
+func readGenesis(path string) (*genesis, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	gen := new(genesis)
+	if err := json.Unmarshal(blob, gen); err != nil {
+		return nil, err
+	}
+	if gen.Alloc == nil {
+		var alloc runtime.GenesisAlloc
+		if err := json.Unmarshal(blob, &alloc); err == nil {
+			gen.Alloc = alloc
+		}
+	}
+	return gen, nil
+}
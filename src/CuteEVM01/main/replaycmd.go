@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	vm "CuteEVM01"
+	"CuteEVM01/runtime"
+)
+
+// replayCmd 实现 "cuteevm replay" 命令:
+// 在空状态上重放由 run --record 写入的执行轨迹，并报告第一处与记录不一致的地方
+func replayCmd(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: cuteevm replay <tracefile>")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing trace file")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	trace, err := vm.DecodeExecutionTrace(f)
+	if err != nil {
+		return fmt.Errorf("failed to read trace: %v", err)
+	}
+	replay, err := runtime.Replay(trace, vm.Config{})
+	if divergence, ok := err.(*vm.TraceDivergence); ok {
+		if divergence.Step >= 0 {
+			step := trace.Steps[divergence.Step]
+			fmt.Printf("recorded step %d: depth %d pc %d %v gas %d cost %d\n", divergence.Step, step.Depth, step.Pc, step.Op, step.Gas, step.Cost)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("replayed %d steps, output 0x%x, gas used %d\n", len(replay.Steps), replay.Output, replay.GasUsed)
+	return nil
+}
+
+// writeTrace 将执行轨迹写入给定文件
+func writeTrace(path string, trace *vm.ExecutionTrace) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := trace.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	vm "CuteEVM01"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/math"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/runtime"
+)
+
+// runFlags 是 run 与 debug 命令共用的执行参数
+type runFlags struct {
+	code, codeFile, input, value string
+	gas                          uint64
+	price, baseFee               string
+	sender, receiver             string
+	fork, prestate, datadir      string
+	remote, remoteBlock          string
+
+	db *runtime.Datadir // 由 --datadir 打开的状态数据库
+}
+
+// addRunFlags 在给定的FlagSet中注册共用的执行参数
+func addRunFlags(fs *flag.FlagSet) *runFlags {
+	f := new(runFlags)
+	fs.StringVar(&f.code, "code", "", "待执行的EVM字节码(十六进制)")
+	fs.StringVar(&f.codeFile, "codefile", "", "包含十六进制EVM字节码的文件, '-' 表示从标准输入读取")
+	fs.StringVar(&f.input, "input", "", "调用数据(十六进制)")
+	fs.StringVar(&f.value, "value", "0", "随调用转移的金额(十进制或0x开头的十六进制)")
+	fs.Uint64Var(&f.gas, "gas", 10000000000, "执行可用的gas上限")
+	fs.StringVar(&f.price, "price", "0", "gas价格(十进制或0x开头的十六进制)")
+	fs.StringVar(&f.baseFee, "basefee", "", "区块的base fee(十进制或0x开头的十六进制)，伦敦分叉之后由BASEFEE返回")
+	fs.StringVar(&f.sender, "sender", "", "调用者地址(默认为 \"sender\" 的字节)")
+	fs.StringVar(&f.receiver, "receiver", "", "被调用的合约地址(默认为 \"receiver\" 的字节)")
+	fs.StringVar(&f.fork, "fork", "", "使用的分叉规则: "+strings.Join(runtime.AvailableForks(), ", ")+" (默认使用预状态中的config, 否则为Petersburg)")
+	fs.StringVar(&f.prestate, "prestate", "", "genesis格式的预状态JSON文件(config, alloc及区块环境)")
+	fs.StringVar(&f.datadir, "datadir", "", "保存状态的LevelDB数据目录: 从上一次提交的状态开始执行，结束后提交执行后的状态")
+	fs.StringVar(&f.remote, "remote", "", "JSON-RPC节点的HTTP地址: 在该节点的状态上执行，用到的账户和存储按需从节点获取，同时给出 --datadir 时缓存在数据目录中")
+	fs.StringVar(&f.remoteBlock, "remote-block", "", "--remote 使用的区块号(默认为数据目录中的状态所基于的区块，否则为节点的最新区块)，同时作为执行时的区块号")
+	return f
+}
+
+// setup 根据参数构造状态与执行配置，把代码部署到接收者地址，并返回接收者地址与调用数据。
+// 给出 --datadir 时状态来自数据目录中最后一次提交的状态，给出 --remote 时状态来自远程节点，
+// 两者同时给出时从远程节点获取的数据缓存在数据目录中，改动提交到数据目录，否则为空的内存状态
+func (f *runFlags) setup() (*runtime.Config, common.Address, []byte, error) {
+	receiver := common.BytesToAddress([]byte("receiver"))
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	cfg := &runtime.Config{
+		State:    statedb,
+		GasLimit: f.gas,
+		Origin:   common.BytesToAddress([]byte("sender")),
+	}
+	if f.datadir != "" {
+		db, err := runtime.OpenDatadir(f.datadir)
+		if err != nil {
+			return nil, receiver, nil, err
+		}
+		f.db = db
+	}
+	if f.remote != "" {
+		var block *big.Int
+		if f.remoteBlock != "" {
+			var ok bool
+			if block, ok = math.ParseBig256(f.remoteBlock); !ok {
+				return nil, receiver, nil, fmt.Errorf("invalid remote block %q", f.remoteBlock)
+			}
+		} else if f.db != nil {
+			// 数据目录中的状态基于远程节点时，默认继续使用同一个区块
+			if number, ok := f.db.RemoteBlock(); ok {
+				block = new(big.Int).SetUint64(number)
+			}
+		}
+		backend, err := state.NewRPCBackend(f.remote, block)
+		if err != nil {
+			return nil, receiver, nil, fmt.Errorf("failed to connect to remote: %v", err)
+		}
+		if f.db != nil {
+			if err := f.db.UseRemote(backend); err != nil {
+				return nil, receiver, nil, err
+			}
+		} else {
+			statedb, _ = state.New(common.Hash{}, state.NewRemoteDatabase(rawdb.NewMemoryDatabase(), backend))
+		}
+		cfg.BlockNumber = new(big.Int).SetUint64(backend.Block())
+	}
+	if f.db != nil {
+		var err error
+		if statedb, err = f.db.State(); err != nil {
+			return nil, receiver, nil, err
+		}
+	}
+	cfg.State = statedb
+
+	// 读取预状态，它可能同时提供了链配置与区块环境
+	if f.prestate != "" {
+		gen, err := readGenesis(f.prestate)
+		if err != nil {
+			return nil, receiver, nil, fmt.Errorf("failed to read prestate: %v", err)
+		}
+		gen.Alloc.Apply(statedb)
+
+		cfg.ChainConfig = gen.Config
+		cfg.Coinbase = gen.Coinbase
+		cfg.BlockNumber = new(big.Int).SetUint64(uint64(gen.Number))
+		if gen.Timestamp != 0 {
+			cfg.Time = new(big.Int).SetUint64(uint64(gen.Timestamp))
+		}
+		if gen.Difficulty != nil {
+			cfg.Difficulty = (*big.Int)(gen.Difficulty)
+		}
+		if gen.BaseFee != nil {
+			cfg.BaseFee = (*big.Int)(gen.BaseFee)
+		}
+	}
+	switch {
+	case f.fork != "":
+		config, err := runtime.ForkConfig(f.fork)
+		if err != nil {
+			return nil, receiver, nil, err
+		}
+		cfg.ChainConfig = config
+	case cfg.ChainConfig == nil:
+		cfg.ChainConfig, _ = runtime.ForkConfig("Petersburg")
+	}
+
+	if f.sender != "" {
+		if !common.IsHexAddress(f.sender) {
+			return nil, receiver, nil, fmt.Errorf("invalid sender address %q", f.sender)
+		}
+		cfg.Origin = common.HexToAddress(f.sender)
+	}
+	if f.receiver != "" {
+		if !common.IsHexAddress(f.receiver) {
+			return nil, receiver, nil, fmt.Errorf("invalid receiver address %q", f.receiver)
+		}
+		receiver = common.HexToAddress(f.receiver)
+	}
+	value, ok := math.ParseBig256(f.value)
+	if !ok {
+		return nil, receiver, nil, fmt.Errorf("invalid value %q", f.value)
+	}
+	cfg.Value = value
+	price, ok := math.ParseBig256(f.price)
+	if !ok {
+		return nil, receiver, nil, fmt.Errorf("invalid gas price %q", f.price)
+	}
+	cfg.GasPrice = price
+	if f.baseFee != "" {
+		baseFee, ok := math.ParseBig256(f.baseFee)
+		if !ok {
+			return nil, receiver, nil, fmt.Errorf("invalid base fee %q", f.baseFee)
+		}
+		cfg.BaseFee = baseFee
+	}
+
+	input, err := parseHex(f.input)
+	if err != nil {
+		return nil, receiver, nil, fmt.Errorf("invalid input: %v", err)
+	}
+	code, err := readCode(f.code, f.codeFile)
+	if err != nil {
+		return nil, receiver, nil, err
+	}
+	if len(code) > 0 {
+		statedb.SetCode(receiver, code)
+	} else if statedb.GetCodeSize(receiver) == 0 {
+		return nil, receiver, nil, errors.New("no code to execute, use --code, --codefile, a prestate or a datadir with code at the receiver")
+	}
+	return cfg, receiver, input, nil
+}
+
+// finish 检查执行期间的状态访问错误(例如从远程节点获取失败)，
+// 并在给出 --datadir 时将执行后的状态提交到数据目录，打印新的状态根
+func (f *runFlags) finish(cfg *runtime.Config) error {
+	if err := cfg.State.Error(); err != nil {
+		return fmt.Errorf("state access failed: %v", err)
+	}
+	if f.db == nil {
+		return nil
+	}
+	root, err := f.db.Commit(cfg.State, cfg.ChainConfig.IsEIP158(cfg.BlockNumber))
+	if err != nil {
+		return fmt.Errorf("failed to commit state: %v", err)
+	}
+	fmt.Printf("state root: %x\n", root)
+	return nil
+}
+
+// close 关闭由 --datadir 打开的状态数据库
+func (f *runFlags) close() {
+	if f.db != nil {
+		f.db.Close()
+	}
+}
+
+// runCmd 实现 "cuteevm run" 命令:
+// 把代码部署到接收者地址，使用给定的调用数据执行，并打印执行结果。
+// 状态默认为空的内存状态，给出 --datadir 时来自数据目录中最后一次提交的状态，执行后的状态提交回数据目录，
+// 给出 --remote 时来自远程节点，两者同时给出时从远程节点获取的数据缓存在数据目录中
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	var (
+		runFlags   = addRunFlags(fs)
+		postFlag   = fs.String("poststate", "", "执行结束后将状态以alloc格式的JSON写入给定文件")
+		dumpFlag   = fs.Bool("dump", false, "执行结束后打印状态的JSON dump")
+		debugFlag  = fs.Bool("debug", false, "将逐条指令的执行跟踪输出到标准错误")
+		recordFlag = fs.String("record", "", "将执行轨迹及其读取的全部外部输入写入给定文件，可以用 replay 命令重放")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *debugFlag && *recordFlag != "" {
+		return errors.New("--debug and --record are mutually exclusive")
+	}
+	cfg, receiver, input, err := runFlags.setup()
+	defer runFlags.close()
+	if err != nil {
+		return err
+	}
+	statedb := cfg.State
+
+	var logger *vm.StructLogger
+	if *debugFlag {
+		logger = vm.NewStructLogger(nil)
+		cfg.EVMConfig.Debug = true
+		cfg.EVMConfig.Tracer = logger
+	}
+
+	var (
+		ret         []byte
+		leftOverGas uint64
+		trace       *vm.ExecutionTrace
+	)
+	if *recordFlag != "" {
+		ret, leftOverGas, trace, err = runtime.Record(receiver, input, cfg)
+	} else {
+		ret, leftOverGas, err = runtime.Call(receiver, input, cfg)
+	}
+
+	if logger != nil {
+		vm.WriteTrace(os.Stderr, logger.StructLogs())
+	}
+	fmt.Printf("0x%x\n", ret)
+	fmt.Printf("gas used: %d\n", cfg.GasLimit-leftOverGas)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+	}
+	if err := runFlags.finish(cfg); err != nil {
+		return err
+	}
+	if trace != nil {
+		if err := writeTrace(*recordFlag, trace); err != nil {
+			return fmt.Errorf("failed to write trace: %v", err)
+		}
+	}
+	if *postFlag != "" {
+		alloc, err := runtime.DumpAlloc(statedb, cfg.ChainConfig.IsEIP158(cfg.BlockNumber))
+		if err != nil {
+			return fmt.Errorf("failed to dump state: %v", err)
+		}
+		if err := runtime.WriteAlloc(*postFlag, alloc); err != nil {
+			return fmt.Errorf("failed to write poststate: %v", err)
+		}
+	}
+	if *dumpFlag {
+		if _, err := statedb.Commit(cfg.ChainConfig.IsEIP158(cfg.BlockNumber)); err != nil {
+			return fmt.Errorf("failed to commit state: %v", err)
+		}
+		fmt.Println(string(statedb.Dump(false, false, true)))
+	}
+	return nil
+}
+
+// readCode 从 --code 或 --codefile 中读取字节码，两者最多只能给出一个
+func readCode(code, codeFile string) ([]byte, error) {
+	if code != "" && codeFile != "" {
+		return nil, errors.New("--code and --codefile are mutually exclusive")
+	}
+	if codeFile != "" {
+		var (
+			blob []byte
+			err  error
+		)
+		if codeFile == "-" {
+			blob, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			blob, err = ioutil.ReadFile(codeFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read code: %v", err)
+		}
+		code = string(blob)
+	}
+	bytecode, err := parseHex(code)
+	if err != nil {
+		return nil, fmt.Errorf("invalid code: %v", err)
+	}
+	return bytecode, nil
+}
+
+// parseHex 解码可能带有0x前缀的十六进制字符串，并忽略首尾的空白字符
+func parseHex(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	vm "CuteEVM01"
+	"CuteEVM01/tests"
+)
+
+// stateTestCmd 实现 "cuteevm statetest" 命令:
+// 执行给定文件或目录中 GeneralStateTests 格式的测试向量，并按分叉汇总通过情况
+func stateTestCmd(args []string) error {
+	fs := flag.NewFlagSet("statetest", flag.ContinueOnError)
+	var (
+		forkFlag    = fs.String("fork", "", "只报告给定分叉的结果(测试向量中的名称，例如 Berlin)")
+		verboseFlag = fs.Bool("v", false, "同时打印通过和跳过的子测试")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: cuteevm statetest [flags] <file|dir>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing test path")
+	}
+
+	type summary struct{ passed, failed, skipped int }
+	forks := make(map[string]*summary)
+	for _, path := range fs.Args() {
+		results, err := tests.RunStateTests(path, vm.Config{})
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if *forkFlag != "" && result.Fork != *forkFlag {
+				continue
+			}
+			if forks[result.Fork] == nil {
+				forks[result.Fork] = new(summary)
+			}
+			s := forks[result.Fork]
+			switch {
+			case result.Passed():
+				s.passed++
+			case result.Skipped:
+				s.skipped++
+			default:
+				s.failed++
+			}
+			if *verboseFlag || !result.Passed() && !result.Skipped {
+				fmt.Println(result)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(forks))
+	for fork := range forks {
+		names = append(names, fork)
+	}
+	sort.Strings(names)
+	var failed int
+	for _, fork := range names {
+		s := forks[fork]
+		fmt.Printf("%-18s %d/%d passed", fork, s.passed, s.passed+s.failed)
+		if s.skipped > 0 {
+			fmt.Printf(", %d skipped", s.skipped)
+		}
+		fmt.Println()
+		failed += s.failed
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d subtests failed", failed)
+	}
+	return nil
+}
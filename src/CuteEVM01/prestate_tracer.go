@@ -0,0 +1,237 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/hexutil"
+	"CuteEVM01/Out/common/math"
+	"CuteEVM01/Out/crypto"
+)
+
+// PrestateAccount 是执行过程中访问到的一个账户的状态。
+// JSON格式与 runtime.GenesisAccount 相同，因此结果可以直接作为 runtime 的预状态fixture载入
+type PrestateAccount struct {
+	Balance *math.HexOrDecimal256       `json:"balance"`
+	Nonce   math.HexOrDecimal64         `json:"nonce,omitempty"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// PrestateAlloc 是地址到账户状态的映射，格式与genesis文件中的 "alloc" 部分相同
+type PrestateAlloc map[common.Address]*PrestateAccount
+
+// PrestateDiff 是差异模式下的结果。
+// Pre 与非差异模式相同，包含所有被访问账户和存储槽的原始值；
+// Post 只包含执行后发生变化的账户，其中的存储只列出值发生变化的存储槽，被删除的账户不会出现在 Post 中
+type PrestateDiff struct {
+	Pre  PrestateAlloc `json:"pre"`
+	Post PrestateAlloc `json:"post"`
+}
+
+// PrestateTracer 是一个实现了 Tracer 的预状态记录器。
+//
+// 它在每个账户和存储槽第一次被访问(BALANCE、EXTCODE*、SLOAD、SSTORE、调用目标及SELFDESTRUCT的受益人)、
+// 也就是在被修改之前，从 StateDB 中读取它们的余额、nonce、代码和存储，执行结束后的 Result
+// 足以在一个独立的状态中重现这次调用。执行中新创建的账户不属于预状态。
+type PrestateTracer struct {
+	statedb  StateDB
+	diffMode bool
+
+	pre   PrestateAlloc
+	seen  map[common.Address]struct{}                 // 已经查询过的账户，包括当时不存在的账户
+	slots map[common.Address]map[common.Hash]struct{} // 所有被访问过的存储槽
+	post  PrestateAlloc
+}
+
+// NewPrestateTracer 返回一个从给定状态中读取原始值的预状态记录器，
+// statedb 必须是执行所使用的状态。diffMode 为true时会在执行结束后额外记录变化后的状态
+func NewPrestateTracer(statedb StateDB, diffMode bool) *PrestateTracer {
+	return &PrestateTracer{
+		statedb:  statedb,
+		diffMode: diffMode,
+		pre:      make(PrestateAlloc),
+		seen:     make(map[common.Address]struct{}),
+		slots:    make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// CaptureStart 记录调用者和接收者的原始状态。
+// 调用 CaptureStart 时value已经转移、创建合约时调用者的nonce已经增加，这里将其还原
+func (t *PrestateTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	if create {
+		t.seen[to] = struct{}{}
+	} else {
+		t.lookupAccount(to)
+	}
+	t.lookupAccount(from)
+
+	if value == nil {
+		value = new(big.Int)
+	}
+	if account := t.pre[from]; account != nil {
+		if from != to {
+			balance := new(big.Int).Add((*big.Int)(account.Balance), value)
+			account.Balance = (*math.HexOrDecimal256)(balance)
+		}
+		if create && account.Nonce > 0 {
+			account.Nonce--
+		}
+	}
+	if account := t.pre[to]; account != nil && !create && from != to {
+		balance := new(big.Int).Sub((*big.Int)(account.Balance), value)
+		account.Balance = (*math.HexOrDecimal256)(balance)
+		// 接收者可能是在调用时才被创建的空账户
+		if balance.Sign() == 0 && account.Nonce == 0 && len(account.Code) == 0 && len(account.Storage) == 0 {
+			delete(t.pre, to)
+		}
+	}
+	return nil
+}
+
+// CaptureState 在指令执行之前记录它将要访问的账户和存储槽
+func (t *PrestateTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if err != nil {
+		return nil
+	}
+	caller := contract.Address()
+	t.lookupAccount(caller)
+
+	switch {
+	case (op == SLOAD || op == SSTORE) && stack.len() >= 1:
+		t.lookupStorage(caller, common.BigToHash(stack.Back(0)))
+	case (op == BALANCE || op == EXTCODESIZE || op == EXTCODECOPY || op == EXTCODEHASH || op == SELFDESTRUCT) && stack.len() >= 1:
+		t.lookupAccount(common.BigToAddress(stack.Back(0)))
+	case (op == CALL || op == CALLCODE || op == DELEGATECALL || op == STATICCALL) && stack.len() >= 2:
+		t.lookupAccount(common.BigToAddress(stack.Back(1)))
+	case op == CREATE:
+		t.lookupAccount(crypto.CreateAddress(caller, env.StateDB.GetNonce(caller)))
+	case op == CREATE2 && stack.len() >= 4:
+		var (
+			offset = stack.Back(1).Int64()
+			size   = stack.Back(2).Int64()
+			salt   = common.BigToHash(stack.Back(3))
+		)
+		codeHash := crypto.Keccak256(memory.Get(offset, size))
+		t.lookupAccount(crypto.CreateAddress2(caller, salt, codeHash))
+	}
+	return nil
+}
+
+// CaptureFault 实现 Tracer 接口
+func (t *PrestateTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd 在差异模式下记录执行后的状态
+func (t *PrestateTracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) error {
+	if t.diffMode {
+		t.post = t.collectPost()
+	}
+	return nil
+}
+
+// CaptureEnter 实现 Tracer 接口，调用目标已经在调用指令执行之前记录
+func (t *PrestateTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit 实现 Tracer 接口
+func (t *PrestateTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// Result 返回记录的预状态
+func (t *PrestateTracer) Result() PrestateAlloc {
+	return t.pre
+}
+
+// Diff 返回差异模式下执行前后的状态，非差异模式下 Post 为nil
+func (t *PrestateTracer) Diff() *PrestateDiff {
+	return &PrestateDiff{Pre: t.pre, Post: t.post}
+}
+
+// GetResult 以JSON格式返回结果: 非差异模式下为预状态，差异模式下为 {"pre": ..., "post": ...}
+func (t *PrestateTracer) GetResult() (json.RawMessage, error) {
+	if t.diffMode {
+		return json.Marshal(t.Diff())
+	}
+	return json.Marshal(t.pre)
+}
+
+// lookupAccount 在账户第一次被访问时记录它的原始状态，不存在的账户只标记为已访问
+func (t *PrestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.seen[addr]; ok {
+		return
+	}
+	t.seen[addr] = struct{}{}
+	if !t.statedb.Exist(addr) {
+		return
+	}
+	t.pre[addr] = &PrestateAccount{
+		Balance: (*math.HexOrDecimal256)(new(big.Int).Set(t.statedb.GetBalance(addr))),
+		Nonce:   math.HexOrDecimal64(t.statedb.GetNonce(addr)),
+		Code:    common.CopyBytes(t.statedb.GetCode(addr)),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// lookupStorage 在存储槽第一次被访问时记录它的原始值
+func (t *PrestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	if t.slots[addr] == nil {
+		t.slots[addr] = make(map[common.Hash]struct{})
+	}
+	if _, ok := t.slots[addr][key]; ok {
+		return
+	}
+	t.slots[addr][key] = struct{}{}
+	if account := t.pre[addr]; account != nil {
+		account.Storage[key] = t.statedb.GetState(addr, key)
+	}
+}
+
+// collectPost 比较所有被访问账户的当前状态与原始状态，返回发生变化的账户
+func (t *PrestateTracer) collectPost() PrestateAlloc {
+	post := make(PrestateAlloc)
+	for addr := range t.seen {
+		if !t.statedb.Exist(addr) || t.statedb.HasSuicided(addr) {
+			continue
+		}
+		// 只被触碰过的空账户不算作新建的账户
+		if t.pre[addr] == nil && t.statedb.Empty(addr) {
+			continue
+		}
+		var (
+			pre     = t.pre[addr]
+			account = &PrestateAccount{
+				Balance: (*math.HexOrDecimal256)(new(big.Int).Set(t.statedb.GetBalance(addr))),
+				Nonce:   math.HexOrDecimal64(t.statedb.GetNonce(addr)),
+				Code:    common.CopyBytes(t.statedb.GetCode(addr)),
+				Storage: make(map[common.Hash]common.Hash),
+			}
+			modified = pre == nil
+		)
+		for key := range t.slots[addr] {
+			var original common.Hash
+			if pre != nil {
+				original = pre.Storage[key]
+			}
+			if value := t.statedb.GetState(addr, key); value != original {
+				account.Storage[key] = value
+				modified = true
+			}
+		}
+		if pre != nil {
+			if (*big.Int)(pre.Balance).Cmp((*big.Int)(account.Balance)) != 0 || pre.Nonce != account.Nonce || !bytes.Equal(pre.Code, account.Code) {
+				modified = true
+			}
+		}
+		if modified {
+			post[addr] = account
+		}
+	}
+	return post
+}
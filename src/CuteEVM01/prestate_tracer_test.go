@@ -0,0 +1,96 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/params"
+)
+
+func TestPrestateTracer(t *testing.T) {
+	var (
+		sender = common.BytesToAddress([]byte("sender"))
+		target = common.BytesToAddress([]byte("target"))
+		other  = common.BytesToAddress([]byte("other"))
+		callee = common.BytesToAddress([]byte("callee"))
+		slot1  = common.BigToHash(big.NewInt(1))
+		slot2  = common.BigToHash(big.NewInt(2))
+	)
+	// sstore(2, sload(1) + 1); balance(other); call(gas, callee, 5, 0, 0, 0, 0)
+	code := []byte{
+		byte(PUSH1), 1, byte(SLOAD), byte(PUSH1), 1, byte(ADD), byte(PUSH1), 2, byte(SSTORE),
+		byte(PUSH32),
+	}
+	code = append(code, common.LeftPadBytes(other.Bytes(), 32)...)
+	code = append(code, byte(BALANCE), byte(POP))
+	code = append(code, byte(PUSH1), 0, byte(DUP1), byte(DUP1), byte(DUP1), byte(PUSH1), 5, byte(PUSH32))
+	code = append(code, common.LeftPadBytes(callee.Bytes(), 32)...)
+	code = append(code, byte(GAS), byte(CALL), byte(POP), byte(STOP))
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetBalance(sender, big.NewInt(1000))
+	statedb.SetBalance(target, big.NewInt(100))
+	statedb.SetCode(target, code)
+	statedb.SetState(target, slot1, common.BigToHash(big.NewInt(41)))
+	statedb.SetBalance(other, big.NewInt(7))
+
+	tracer := NewPrestateTracer(statedb, true)
+	vmctx := Context{
+		CanTransfer: func(db StateDB, addr common.Address, amount *big.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		},
+		Transfer: func(db StateDB, sender, recipient common.Address, amount *big.Int) {
+			db.SubBalance(sender, amount)
+			db.AddBalance(recipient, amount)
+		},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: tracer})
+	if _, _, err := vmenv.Call(AccountRef(sender), target, nil, 1000000, big.NewInt(10)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	diff := tracer.Diff()
+
+	// 预状态中的余额应是value转移之前的值，新建的 callee 不属于预状态
+	if len(diff.Pre) != 3 {
+		t.Fatalf("pre account count mismatch: have %d, want 3", len(diff.Pre))
+	}
+	if have := (*big.Int)(diff.Pre[sender].Balance); have.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want 1000", have)
+	}
+	pre := diff.Pre[target]
+	if have := (*big.Int)(pre.Balance); have.Cmp(big.NewInt(100)) != 0 {
+		t.Errorf("target balance mismatch: have %v, want 100", have)
+	}
+	if !bytes.Equal(pre.Code, code) {
+		t.Errorf("target code mismatch: have %x, want %x", pre.Code, code)
+	}
+	if len(pre.Storage) != 2 || pre.Storage[slot1] != common.BigToHash(big.NewInt(41)) || pre.Storage[slot2] != (common.Hash{}) {
+		t.Errorf("target storage mismatch: %v", pre.Storage)
+	}
+	if have := (*big.Int)(diff.Pre[other].Balance); have.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("other balance mismatch: have %v, want 7", have)
+	}
+
+	// 只被读取的账户不会出现在 Post 中
+	if _, ok := diff.Post[other]; ok {
+		t.Error("unmodified account in post state")
+	}
+	post := diff.Post[target]
+	if post == nil {
+		t.Fatal("target missing from post state")
+	}
+	if have := (*big.Int)(post.Balance); have.Cmp(big.NewInt(105)) != 0 {
+		t.Errorf("target post balance mismatch: have %v, want 105", have)
+	}
+	if len(post.Storage) != 1 || post.Storage[slot2] != common.BigToHash(big.NewInt(42)) {
+		t.Errorf("target post storage mismatch: %v", post.Storage)
+	}
+	if post := diff.Post[callee]; post == nil || (*big.Int)(post.Balance).Cmp(big.NewInt(5)) != 0 {
+		t.Errorf("callee post state mismatch: %+v", post)
+	}
+}
@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"CuteEVM01/Out/accounts/abi"
+)
+
+var (
+	// revertSelector 是 Solidity 中 Error(string) 的函数选择器
+	revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+	// panicSelector 是 Solidity 中 Panic(uint256) 的函数选择器
+	panicSelector = []byte{0x4e, 0x48, 0x7b, 0x71}
+)
+
+// panicReasons 是 Solidity 编译器定义的 Panic 错误码的含义
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesN",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// RevertError 是执行因REVERT结束时由顶层调用返回的错误，携带解码后的回滚数据。
+//
+// 可以解码的格式包括 Error(string)、Panic(uint256)，以及给定ABI中声明的自定义错误，
+// 无法解码时 ErrorName 为空，只能通过 Data 取得原始的返回数据
+type RevertError struct {
+	data   []byte
+	name   string
+	reason string
+	args   []interface{}
+}
+
+// NewRevertError 解码给定的回滚数据，contractABI 用于查找自定义错误，可以为nil
+func NewRevertError(data []byte, contractABI *abi.ABI) *RevertError {
+	e := &RevertError{data: data}
+	switch {
+	case len(data) >= 4 && bytes.Equal(data[:4], revertSelector):
+		if reason, ok := unpackRevertReason(data); ok {
+			e.name, e.reason, e.args = "Error", reason, []interface{}{reason}
+		}
+	case len(data) == 4+32 && bytes.Equal(data[:4], panicSelector):
+		code := new(big.Int).SetBytes(data[4:])
+		e.name, e.args = "Panic", []interface{}{code}
+		e.reason = fmt.Sprintf("panic: unknown code 0x%x", code)
+		if reason, ok := panicReasons[code.Uint64()]; ok && code.IsUint64() {
+			e.reason = fmt.Sprintf("panic: %s (0x%x)", reason, code)
+		}
+	case len(data) >= 4 && contractABI != nil:
+		custom, err := contractABI.ErrorByID(data)
+		if err != nil {
+			break
+		}
+		args, err := custom.Unpack(data)
+		if err != nil {
+			break
+		}
+		values := make([]string, len(args))
+		for i, arg := range args {
+			values[i] = fmt.Sprintf("%v", arg)
+		}
+		e.name, e.args = custom.Name, args
+		e.reason = fmt.Sprintf("%s(%s)", custom.Name, strings.Join(values, ", "))
+	}
+	return e
+}
+
+// Error 实现 error 接口，能解码时附带回滚原因
+func (e *RevertError) Error() string {
+	if e.reason == "" {
+		return errExecutionReverted.Error()
+	}
+	return errExecutionReverted.Error() + ": " + e.reason
+}
+
+// Unwrap 使 errors.Is(err, errExecutionReverted) 对 RevertError 同样成立
+func (e *RevertError) Unwrap() error {
+	return errExecutionReverted
+}
+
+// Reason 返回可读的回滚原因: Error(string) 中的字符串、Panic 错误码的含义或自定义错误及其参数
+func (e *RevertError) Reason() string {
+	return e.reason
+}
+
+// ErrorName 返回解码出的错误名称，"Error"、"Panic" 或自定义错误的名称，无法解码时为空
+func (e *RevertError) ErrorName() string {
+	return e.name
+}
+
+// Args 返回解码出的错误参数
+func (e *RevertError) Args() []interface{} {
+	return e.args
+}
+
+// Data 返回原始的回滚数据
+func (e *RevertError) Data() []byte {
+	return e.data
+}
+
+// IsRevert 报告给定的错误是否表示执行因REVERT而结束
+func IsRevert(err error) bool {
+	return errors.Is(err, errExecutionReverted)
+}
+
+// wrapRevert 将顶层调用的回滚错误转换为 RevertError，嵌套调用的错误保持不变，
+// 以便调用指令能够区分回滚与其他错误
+func (evm *EVM) wrapRevert(ret []byte, err error) error {
+	if err != errExecutionReverted || evm.depth != 0 {
+		return err
+	}
+	return NewRevertError(ret, evm.vmConfig.ErrorABI)
+}
+
+// unpackRevertReason 解析 Error(string) 编码的回滚数据，数据格式不符时返回false
+func unpackRevertReason(data []byte) (string, bool) {
+	if len(data) < 4+64 || !bytes.Equal(data[:4], revertSelector) {
+		return "", false
+	}
+	data = data[4:]
+	offset := new(big.Int).SetBytes(data[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(data)-32) {
+		return "", false
+	}
+	start := offset.Uint64() + 32
+	size := new(big.Int).SetBytes(data[start-32 : start])
+	if !size.IsUint64() || size.Uint64() > uint64(len(data))-start {
+		return "", false
+	}
+	return string(data[start : start+size.Uint64()]), true
+}
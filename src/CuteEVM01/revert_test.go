@@ -0,0 +1,133 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"CuteEVM01/Out/accounts/abi"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/params"
+)
+
+// encodeRevertReason 按 Error(string) 编码回滚原因，reason 不能超过32字节
+func encodeRevertReason(reason string) []byte {
+	data := common.CopyBytes(revertSelector)
+	data = append(data, common.LeftPadBytes([]byte{0x20}, 32)...)
+	data = append(data, common.LeftPadBytes([]byte{byte(len(reason))}, 32)...)
+	return append(data, common.RightPadBytes([]byte(reason), 32)...)
+}
+
+// revertWithData 返回将给定数据写入内存后以REVERT结束的字节码
+func revertWithData(data []byte) []byte {
+	var code []byte
+	for offset := 0; offset < len(data); offset += 32 {
+		code = append(code, byte(PUSH32))
+		code = append(code, common.RightPadBytes(data[offset:], 32)[:32]...)
+		code = append(code, byte(PUSH1), byte(offset), byte(MSTORE))
+	}
+	return append(code, byte(PUSH1), byte(len(data)), byte(PUSH1), 0, byte(REVERT))
+}
+
+// revertCode 返回以 Error(reason) 回滚的字节码
+func revertCode(reason string) []byte {
+	return revertWithData(encodeRevertReason(reason))
+}
+
+func TestUnpackRevertReason(t *testing.T) {
+	data := encodeRevertReason("boom")
+	if reason, ok := unpackRevertReason(data); !ok || reason != "boom" {
+		t.Errorf("have %q, %v, want \"boom\", true", reason, ok)
+	}
+	// 长度超出数据范围
+	broken := common.CopyBytes(data)
+	broken[4+63] = 0xff
+	if _, ok := unpackRevertReason(broken); ok {
+		t.Error("expected out of bounds length to fail")
+	}
+	if _, ok := unpackRevertReason(data[:40]); ok {
+		t.Error("expected short data to fail")
+	}
+}
+
+const customErrorABI = `[{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]}]`
+
+func TestRevertError(t *testing.T) {
+	contractABI, err := abi.JSON(strings.NewReader(customErrorABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := contractABI.Errors["InsufficientBalance"]
+	customData := append(custom.Id(), common.LeftPadBytes([]byte{1}, 32)...)
+	customData = append(customData, common.LeftPadBytes([]byte{2}, 32)...)
+
+	tests := []struct {
+		data   []byte
+		abi    *abi.ABI
+		name   string
+		reason string
+	}{
+		{encodeRevertReason("boom"), nil, "Error", "boom"},
+		{append(common.CopyBytes(panicSelector), common.LeftPadBytes([]byte{0x11}, 32)...), nil, "Panic", "panic: arithmetic underflow or overflow (0x11)"},
+		{append(common.CopyBytes(panicSelector), common.LeftPadBytes([]byte{0x99}, 32)...), nil, "Panic", "panic: unknown code 0x99"},
+		{customData, &contractABI, "InsufficientBalance", "InsufficientBalance(1, 2)"},
+		// 没有ABI时无法解码自定义错误
+		{customData, nil, "", ""},
+		{nil, nil, "", ""},
+	}
+	for i, tt := range tests {
+		e := NewRevertError(tt.data, tt.abi)
+		if e.ErrorName() != tt.name || e.Reason() != tt.reason {
+			t.Errorf("test %d: have %q/%q, want %q/%q", i, e.ErrorName(), e.Reason(), tt.name, tt.reason)
+		}
+		if !bytes.Equal(e.Data(), tt.data) || !IsRevert(e) {
+			t.Errorf("test %d: unexpected data %x or revert status", i, e.Data())
+		}
+	}
+	if args := NewRevertError(customData, &contractABI).Args(); len(args) != 2 || args[1].(*big.Int).Int64() != 2 {
+		t.Errorf("custom error args mismatch: %v", args)
+	}
+}
+
+func TestCallReturnsRevertError(t *testing.T) {
+	var (
+		caller = common.BytesToAddress([]byte("caller"))
+		callee = common.BytesToAddress([]byte("callee"))
+		out    bytes.Buffer
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetCode(callee, revertCode("boom"))
+	// 调用 callee 后以 Panic(0x01) 回滚
+	code := []byte{byte(PUSH1), 0, byte(DUP1), byte(DUP1), byte(DUP1), byte(DUP1), byte(PUSH32)}
+	code = append(code, common.LeftPadBytes(callee.Bytes(), 32)...)
+	code = append(code, byte(GAS), byte(CALL), byte(POP))
+	code = append(code, revertWithData(append(common.CopyBytes(panicSelector), common.LeftPadBytes([]byte{1}, 32)...))...)
+	statedb.SetCode(caller, code)
+
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+	vmenv := NewEVM(vmctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: NewJSONLogger(&LogConfig{DisableMemory: true, DisableStack: true}, &out)})
+	_, _, err := vmenv.Call(AccountRef(common.Address{}), caller, nil, 1000000, new(big.Int))
+
+	var revert *RevertError
+	if !errors.As(err, &revert) {
+		t.Fatalf("expected *RevertError, have %T: %v", err, err)
+	}
+	if revert.ErrorName() != "Panic" || revert.Reason() != "panic: assert(false) (0x1)" {
+		t.Errorf("unexpected revert: %v", revert)
+	}
+	// JSON 日志的结束记录中应带有解码后的原因
+	if !strings.Contains(out.String(), `"error":"evm: execution reverted: panic: assert(false) (0x1)"`) {
+		t.Errorf("revert reason missing from JSON log:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `"revertReason":"panic: assert(false) (0x1)"`) {
+		t.Errorf("revertReason field missing from JSON log:\n%s", out.String())
+	}
+}
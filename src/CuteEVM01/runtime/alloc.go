@@ -0,0 +1,123 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/hexutil"
+	"CuteEVM01/Out/common/math"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/rlp"
+)
+
+// GenesisAccount 是genesis格式的状态文件中的单个账户
+type GenesisAccount struct {
+	Balance *math.HexOrDecimal256       `json:"balance"`
+	Nonce   math.HexOrDecimal64         `json:"nonce,omitempty"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// GenesisAlloc 是genesis文件中的 "alloc" 部分: 地址到账户内容的映射。
+// 它既可以作为执行前的预状态载入StateDB，也可以由执行后的状态导出，以便作为fixture保存和比对
+type GenesisAlloc map[common.Address]GenesisAccount
+
+// UnmarshalJSON 解析alloc，地址的0x前缀是可选的
+func (ga *GenesisAlloc) UnmarshalJSON(data []byte) error {
+	m := make(map[common.UnprefixedAddress]GenesisAccount)
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*ga = make(GenesisAlloc, len(m))
+	for addr, account := range m {
+		(*ga)[common.Address(addr)] = account
+	}
+	return nil
+}
+
+// ReadAlloc 从给定的JSON文件中读取alloc
+func ReadAlloc(path string) (GenesisAlloc, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var alloc GenesisAlloc
+	if err := json.Unmarshal(blob, &alloc); err != nil {
+		return nil, fmt.Errorf("invalid alloc file %s: %v", path, err)
+	}
+	return alloc, nil
+}
+
+// WriteAlloc 将alloc以缩进的JSON格式写入给定的文件。地址与存储槽按键排序输出，方便对结果做diff
+func WriteAlloc(path string, alloc GenesisAlloc) error {
+	blob, err := json.MarshalIndent(alloc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(blob, '\n'), 0644)
+}
+
+// Apply 将alloc中的所有账户写入给定的状态
+func (ga GenesisAlloc) Apply(statedb *state.StateDB) {
+	for addr, account := range ga {
+		statedb.CreateAccount(addr)
+		if account.Balance != nil {
+			statedb.SetBalance(addr, (*big.Int)(account.Balance))
+		}
+		statedb.SetNonce(addr, uint64(account.Nonce))
+		if len(account.Code) > 0 {
+			statedb.SetCode(addr, account.Code)
+		}
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+}
+
+// NewState 创建一个基于内存数据库的新状态，并写入alloc中的账户。
+// 返回值可以直接作为 Config.State 使用
+func NewState(alloc GenesisAlloc) *state.StateDB {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	alloc.Apply(statedb)
+	return statedb
+}
+
+// DumpAlloc 提交给定的状态并将其 state.Dump 转换为alloc，输出格式与 ReadAlloc 读取的格式相同。
+//
+// 提交是必需的: 只有这样存储键的原像才会写入trie数据库，dump才能还原出存储槽的键
+func DumpAlloc(statedb *state.StateDB, deleteEmptyObjects bool) (GenesisAlloc, error) {
+	if _, err := statedb.Commit(deleteEmptyObjects); err != nil {
+		return nil, err
+	}
+	dump := statedb.RawDump(false, false, true)
+
+	alloc := make(GenesisAlloc, len(dump.Accounts))
+	for addr, account := range dump.Accounts {
+		balance, ok := new(big.Int).SetString(account.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid balance %q for account %x", account.Balance, addr)
+		}
+		genesisAccount := GenesisAccount{
+			Balance: (*math.HexOrDecimal256)(balance),
+			Nonce:   math.HexOrDecimal64(account.Nonce),
+			Code:    common.Hex2Bytes(account.Code),
+		}
+		if len(account.Storage) > 0 {
+			genesisAccount.Storage = make(map[common.Hash]common.Hash, len(account.Storage))
+		}
+		for key, enc := range account.Storage {
+			// dump中的存储值是trie中RLP编码后的原始值
+			_, content, _, err := rlp.Split(common.Hex2Bytes(enc))
+			if err != nil {
+				return nil, fmt.Errorf("invalid storage value %q for account %x: %v", enc, addr, err)
+			}
+			genesisAccount.Storage[key] = common.BytesToHash(content)
+		}
+		alloc[addr] = genesisAccount
+	}
+	return alloc, nil
+}
@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"fmt"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/ethdb"
+)
+
+// Datadir 是保存在磁盘上的LevelDB状态数据库。每次执行都从上一次提交的状态开始，
+// 执行结束后提交的状态可以被之后的执行继续使用，就像一条只有状态的开发链
+type Datadir struct {
+	diskdb ethdb.Database
+	db     state.Database
+	root   common.Hash // 最后一次提交的状态根，新建的数据目录为空哈希
+	block  *uint64     // 最后一次提交的状态所基于的远程区块，不基于远程节点时为nil
+	remote bool        // 状态数据库是否由远程节点支持
+}
+
+// OpenDatadir 打开(或创建)给定目录中的状态数据库，并读取最后一次提交的状态根
+func OpenDatadir(path string) (*Datadir, error) {
+	diskdb, err := rawdb.NewLevelDBDatabase(path, 16, 16, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open datadir %s: %v", path, err)
+	}
+	return &Datadir{
+		diskdb: diskdb,
+		db:     state.NewDatabase(diskdb),
+		root:   rawdb.ReadHeadStateRoot(diskdb),
+		block:  rawdb.ReadHeadRemoteBlock(diskdb),
+	}, nil
+}
+
+// Root 返回最后一次提交的状态根
+func (d *Datadir) Root() common.Hash {
+	return d.root
+}
+
+// RemoteBlock 返回最后一次提交的状态所基于的远程区块号，状态不基于远程节点时返回false
+func (d *Datadir) RemoteBlock() (uint64, bool) {
+	if d.block == nil {
+		return 0, false
+	}
+	return *d.block, true
+}
+
+// UseRemote 让状态数据库在给定的远程节点的状态上执行，从节点获取的数据缓存在数据目录中。
+// 已提交的状态基于其他区块或者不基于远程节点时返回错误，一个区块的状态不会被用于另一个区块
+func (d *Datadir) UseRemote(backend state.RemoteBackend) error {
+	block := backend.Block()
+	switch {
+	case d.block != nil && *d.block != block:
+		return fmt.Errorf("datadir state forks off remote block %d, not %d", *d.block, block)
+	case d.block == nil && d.root != (common.Hash{}):
+		return fmt.Errorf("datadir state does not fork off a remote block")
+	}
+	d.db = state.NewRemoteDatabase(d.diskdb, backend)
+	d.block, d.remote = &block, true
+	return nil
+}
+
+// State 返回最后一次提交的状态
+func (d *Datadir) State() (*state.StateDB, error) {
+	if d.block != nil && !d.remote {
+		return nil, fmt.Errorf("datadir state forks off remote block %d, a remote backend is required", *d.block)
+	}
+	statedb, err := state.New(d.root, d.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state %x: %v", d.root, err)
+	}
+	return statedb, nil
+}
+
+// Commit 将状态的改动写入磁盘，并把新的状态根记录为之后执行的起点。
+// 基于远程节点的状态同时记录所基于的区块号
+func (d *Datadir) Commit(statedb *state.StateDB, deleteEmptyObjects bool) (common.Hash, error) {
+	root, err := statedb.Commit(deleteEmptyObjects)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := d.db.TrieDB().Commit(root, false); err != nil {
+		return common.Hash{}, err
+	}
+	if d.block != nil {
+		rawdb.WriteHeadRemoteBlock(d.diskdb, *d.block)
+	}
+	rawdb.WriteHeadStateRoot(d.diskdb, root)
+	d.root = root
+	return root, nil
+}
+
+// Close 关闭状态数据库，未提交的改动会被丢弃
+func (d *Datadir) Close() error {
+	return d.diskdb.Close()
+}
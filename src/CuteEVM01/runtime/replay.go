@@ -0,0 +1,125 @@
+package runtime
+
+import (
+	"fmt"
+
+	"CuteEVM01"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+)
+
+// Record 与 Call 相同，但同时记录执行轨迹，记录期间 cfg.EVMConfig 中的 Tracer 不会被调用
+func Record(address common.Address, input []byte, cfg *Config) ([]byte, uint64, *vm.ExecutionTrace, error) {
+	setDefaults(cfg)
+
+	rec := vm.NewTraceRecorder(cfg.ChainConfig)
+	envCfg := *cfg
+	envCfg.EVMConfig.Debug = true
+	envCfg.EVMConfig.Tracer = rec
+	vmEnv := NewEnv(&envCfg)
+	vmEnv.Context = rec.WrapContext(vmEnv.Context)
+	vmEnv.StateDB = rec.WrapStateDB(cfg.State)
+
+	sender := cfg.State.GetOrNewStateObject(cfg.Origin)
+	prepareAccessList(cfg, vmEnv, &address)
+	ret, leftOverGas, err := vmEnv.Call(
+		sender,
+		address,
+		input,
+		cfg.GasLimit,
+		cfg.Value,
+	)
+	return ret, leftOverGas, rec.Trace(), err
+}
+
+// Replay 在只包含轨迹中记录的状态的空数据库上重新执行轨迹，返回重放得到的轨迹。
+// 重放与记录不一致时返回描述第一处不同的 *vm.TraceDivergence
+func Replay(trace *vm.ExecutionTrace, vmConfig vm.Config) (*vm.ExecutionTrace, error) {
+	config, err := trace.Config()
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain config: %v", err)
+	}
+	statedb, err := replayState(trace)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[uint64]common.Hash, len(trace.Context.Hashes))
+	for _, h := range trace.Context.Hashes {
+		hashes[h.Number] = h.Hash
+	}
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     func(n uint64) common.Hash { return hashes[n] },
+
+		Origin:      trace.Context.Origin,
+		GasPrice:    trace.Context.GasPrice,
+		Coinbase:    trace.Context.Coinbase,
+		GasLimit:    trace.Context.GasLimit,
+		BlockNumber: trace.Context.BlockNumber,
+		Time:        trace.Context.Time,
+		BaseFee:     trace.Context.BaseFee,
+		Difficulty:  trace.Context.Difficulty,
+	}
+	rec := vm.NewTraceRecorder(config)
+	vmConfig.Debug = true
+	vmConfig.Tracer = rec
+	vmEnv := vm.NewEVM(rec.WrapContext(context), rec.WrapStateDB(statedb), config, vmConfig)
+
+	call := trace.Call
+	if call.Create {
+		vmEnv.Create(vm.AccountRef(call.From), call.Input, call.Gas, call.Value)
+	} else {
+		vmEnv.Call(vm.AccountRef(call.From), call.To, call.Input, call.Gas, call.Value)
+	}
+	replay := rec.Trace()
+	return replay, trace.Compare(replay)
+}
+
+// replayState 构造只包含轨迹中记录的账户、存储槽、访问列表和退款计数的状态
+func replayState(trace *vm.ExecutionTrace) (*state.StateDB, error) {
+	db := state.NewDatabase(rawdb.NewMemoryDatabase())
+	statedb, _ := state.New(common.Hash{}, db)
+	for _, account := range trace.Accounts {
+		if !account.Exists {
+			continue
+		}
+		statedb.CreateAccount(account.Address)
+		statedb.AddBalance(account.Address, account.Balance)
+		statedb.SetNonce(account.Address, account.Nonce)
+		if len(account.Code) > 0 {
+			statedb.SetCode(account.Address, account.Code)
+		}
+		for _, slot := range account.Storage {
+			statedb.SetState(account.Address, slot.Key, slot.Original)
+		}
+	}
+	// 提交原始值，使 GetCommittedState 返回交易开始时的值，再写入执行开始前已被修改的值
+	root, err := statedb.Commit(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit replay state: %v", err)
+	}
+	statedb, err = state.New(root, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range trace.Accounts {
+		for _, slot := range account.Storage {
+			if slot.Value != slot.Original {
+				statedb.SetState(account.Address, slot.Key, slot.Value)
+			}
+		}
+	}
+	for _, entry := range trace.AccessList {
+		if entry.Warm {
+			statedb.AddAddressToAccessList(entry.Address)
+		}
+		for _, slot := range entry.Slots {
+			statedb.AddSlotToAccessList(entry.Address, slot)
+		}
+	}
+	statedb.AddRefund(trace.Refund)
+	return statedb, nil
+}
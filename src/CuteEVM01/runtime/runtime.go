@@ -25,6 +25,7 @@ type Config struct {
 	Time        *big.Int
 	GasLimit    uint64
 	GasPrice    *big.Int
+	BaseFee     *big.Int
 	Value       *big.Int
 	Debug       bool
 	EVMConfig   vm.Config
@@ -62,6 +63,9 @@ func setDefaults(cfg *Config) {
 	if cfg.Value == nil {
 		cfg.Value = new(big.Int)
 	}
+	if cfg.BaseFee == nil {
+		cfg.BaseFee = big.NewInt(params.InitialBaseFee)
+	}
 	if cfg.BlockNumber == nil {
 		cfg.BlockNumber = new(big.Int)
 	}
@@ -91,6 +95,7 @@ func Execute(code, input []byte, cfg *Config) ([]byte, *state.StateDB, error) {
 		sender  = vm.AccountRef(cfg.Origin)
 	)
 	fmt.Println("origin是",cfg.Origin)
+	prepareAccessList(cfg, vmEnv, &address)
 	cfg.State.CreateAccount(address)
 	//设置receiver(the executing contract)的执行代码。
 	cfg.State.SetCode(address, code)
@@ -121,6 +126,11 @@ func Create(input []byte, cfg *Config) ([]byte, common.Address, uint64, error) {
 		vmEnv  = NewEnv(cfg)
 		sender = vm.AccountRef(cfg.Origin)
 	)
+	prepareAccessList(cfg, vmEnv, nil)
+	// EIP-3860: 上海分叉之后，创建合约交易的初始化代码大小受到限制
+	if cfg.ChainConfig.IsShanghai(cfg.BlockNumber) && len(input) > params.MaxInitCodeSize {
+		return nil, common.Address{}, cfg.GasLimit, vm.ErrMaxInitCodeSizeExceeded
+	}
 
 	// 使用给定的配置调用代码。
 	code, address, leftOverGas, err := vmEnv.Create(
@@ -141,6 +151,7 @@ func Call(address common.Address, input []byte, cfg *Config) ([]byte, uint64, er
 	vmEnv := NewEnv(cfg)
 
 	sender := cfg.State.GetOrNewStateObject(cfg.Origin)
+	prepareAccessList(cfg, vmEnv, &address)
 	// 使用给定的配置调用代码
 	ret, leftOverGas, err := vmEnv.Call(
 		sender,
@@ -151,3 +162,17 @@ func Call(address common.Address, input []byte, cfg *Config) ([]byte, uint64, er
 	)
 	return ret, leftOverGas, err
 }
+
+// prepareAccessList 在柏林分叉之后为一次顶层执行重置访问列表(EIP-2929):
+// 调用者、被调用者(创建合约时为nil)以及所有预编译合约(包括自定义的)从一开始就是热访问的，
+// 上海分叉之后coinbase也是热访问的(EIP-3651)
+func prepareAccessList(cfg *Config, vmEnv *vm.EVM, dest *common.Address) {
+	rules := cfg.ChainConfig.Rules(cfg.BlockNumber)
+	if !rules.IsBerlin {
+		return
+	}
+	cfg.State.PrepareAccessList(cfg.Origin, dest, vmEnv.ActivePrecompiles())
+	if rules.IsShanghai {
+		cfg.State.AddAddressToAccessList(cfg.Coinbase)
+	}
+}
@@ -1,15 +1,23 @@
 package runtime
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"CuteEVM01"
 	"CuteEVM01/Out/accounts/abi"
 	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/math"
 	"CuteEVM01/Out/core/rawdb"
 	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/crypto"
 	"CuteEVM01/Out/params"
 )
 
@@ -41,6 +49,24 @@ func TestDefaults(t *testing.T) {
 	}
 }
 
+func TestForkConfig(t *testing.T) {
+	config, err := ForkConfig("byzantium")
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	if !config.IsByzantium(new(big.Int)) || config.IsConstantinople(new(big.Int)) {
+		t.Errorf("unexpected fork rules for byzantium: %v", config)
+	}
+	// 返回的配置是副本，修改它不应影响共享的分叉表
+	config.ConstantinopleBlock = new(big.Int)
+	if Forks["Byzantium"].ConstantinopleBlock != nil {
+		t.Error("expected ForkConfig to return a copy")
+	}
+	if _, err := ForkConfig("nosuchfork"); err == nil {
+		t.Error("expected error for unknown fork")
+	}
+}
+
 func TestEVM(t *testing.T) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -101,6 +127,490 @@ func TestCall(t *testing.T) {
 	}
 }
 
+func TestIstanbulOpcodes(t *testing.T) {
+	config, err := ForkConfig("Istanbul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ChainID = big.NewInt(1337)
+
+	address := common.HexToAddress("0x0b")
+	// mstore(0, chainid()); mstore(32, selfbalance()); return(0, 64)
+	code := []byte{
+		byte(vm.CHAINID),
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.SELFBALANCE),
+		byte(vm.PUSH1), 32,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 64,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	}
+	cfg := &Config{
+		ChainConfig: config,
+		State: NewState(GenesisAlloc{
+			address: {Balance: math.NewHexOrDecimal256(42), Code: code},
+		}),
+	}
+	ret, _, err := Call(address, nil, cfg)
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	if have := new(big.Int).SetBytes(ret[:32]); have.Cmp(big.NewInt(1337)) != 0 {
+		t.Errorf("chainid mismatch: have %v, want 1337", have)
+	}
+	if have := new(big.Int).SetBytes(ret[32:]); have.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("selfbalance mismatch: have %v, want 42", have)
+	}
+
+	// 伊斯坦布尔之前的分叉中这两个操作码是无效的
+	cfg = &Config{ChainConfig: Forks["Petersburg"], State: NewState(GenesisAlloc{address: {Code: code}})}
+	if _, _, err := Call(address, nil, cfg); err == nil {
+		t.Error("expected invalid opcode error before Istanbul")
+	}
+}
+
+func TestLondonShanghaiOpcodes(t *testing.T) {
+	address := common.HexToAddress("0x0b")
+	// mstore(0, basefee()); mstore(32, push0()); return(0, 64)
+	code := []byte{
+		byte(vm.BASEFEE),
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 1,
+		byte(vm.PUSH0),
+		byte(vm.ADD),
+		byte(vm.PUSH1), 32,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 64,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	}
+	cfg := &Config{
+		ChainConfig: Forks["Shanghai"],
+		BaseFee:     big.NewInt(7),
+		State:       NewState(GenesisAlloc{address: {Code: code}}),
+	}
+	ret, _, err := Call(address, nil, cfg)
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	if have := new(big.Int).SetBytes(ret[:32]); have.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("basefee mismatch: have %v, want 7", have)
+	}
+	if have := new(big.Int).SetBytes(ret[32:]); have.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("push0 mismatch: have %v, want 1", have)
+	}
+	// 伦敦分叉中还没有PUSH0
+	cfg = &Config{ChainConfig: Forks["London"], State: NewState(GenesisAlloc{address: {Code: code}})}
+	if _, _, err := Call(address, nil, cfg); err == nil {
+		t.Error("expected invalid opcode error before Shanghai")
+	}
+}
+
+func TestRejectEFCode(t *testing.T) {
+	// mstore8(0, 0xef); return(0, 1)
+	initcode := []byte{
+		byte(vm.PUSH1), 0xef,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE8),
+		byte(vm.PUSH1), 1,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	}
+	if _, _, _, err := Create(initcode, &Config{ChainConfig: Forks["London"]}); err != vm.ErrInvalidCode {
+		t.Errorf("london: have %v, want %v", err, vm.ErrInvalidCode)
+	}
+	if _, _, _, err := Create(initcode, &Config{ChainConfig: Forks["Berlin"]}); err != nil {
+		t.Errorf("berlin: didn't expect error: %v", err)
+	}
+}
+
+func TestMaxInitCodeSize(t *testing.T) {
+	initcode := make([]byte, params.MaxInitCodeSize+1)
+	if _, _, _, err := Create(initcode, &Config{ChainConfig: Forks["Shanghai"]}); err != vm.ErrMaxInitCodeSizeExceeded {
+		t.Errorf("have %v, want %v", err, vm.ErrMaxInitCodeSizeExceeded)
+	}
+}
+
+func TestTransientStorage(t *testing.T) {
+	address := common.HexToAddress("0x0b")
+	// tstore(0, tload(0) + 1); return tload(0)
+	code := []byte{
+		byte(vm.PUSH1), 0,
+		byte(vm.TLOAD),
+		byte(vm.PUSH1), 1,
+		byte(vm.ADD),
+		byte(vm.PUSH1), 0,
+		byte(vm.TSTORE),
+		byte(vm.PUSH1), 0,
+		byte(vm.TLOAD),
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	}
+	cfg := &Config{
+		ChainConfig: Forks["Cancun"],
+		State:       NewState(GenesisAlloc{address: {Code: code}}),
+	}
+	// 每次顶层调用结束后临时存储都会被清空，因此两次调用的结果相同
+	for i := 0; i < 2; i++ {
+		ret, _, err := Call(address, nil, cfg)
+		if err != nil {
+			t.Fatal("didn't expect error", err)
+		}
+		if have := new(big.Int).SetBytes(ret); have.Cmp(big.NewInt(1)) != 0 {
+			t.Errorf("call %d: have %v, want 1", i, have)
+		}
+	}
+	// 临时存储的修改可以随快照回滚
+	var (
+		statedb = cfg.State
+		key     = common.BytesToHash([]byte{1})
+	)
+	statedb.SetTransientState(address, key, common.BytesToHash([]byte{1}))
+	snapshot := statedb.Snapshot()
+	statedb.SetTransientState(address, key, common.BytesToHash([]byte{2}))
+	statedb.RevertToSnapshot(snapshot)
+	if have := statedb.GetTransientState(address, key); have != common.BytesToHash([]byte{1}) {
+		t.Errorf("transient state not reverted: have %x", have)
+	}
+}
+
+func TestMcopy(t *testing.T) {
+	address := common.HexToAddress("0x0b")
+	// mstore(0, 0x0102..20); mcopy(1, 0, 32); return(0, 33)
+	word := make([]byte, 32)
+	for i := range word {
+		word[i] = byte(i + 1)
+	}
+	code := append([]byte{byte(vm.PUSH32)}, word...)
+	code = append(code,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 1,
+		byte(vm.MCOPY),
+		byte(vm.PUSH1), 33,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	)
+	cfg := &Config{
+		ChainConfig: Forks["Cancun"],
+		State:       NewState(GenesisAlloc{address: {Code: code}}),
+	}
+	ret, _, err := Call(address, nil, cfg)
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	// 源区域与目标区域重叠时，结果应与先复制到临时缓冲区再写入相同
+	want := append([]byte{1}, word...)
+	if !bytes.Equal(ret, want) {
+		t.Errorf("have %x, want %x", ret, want)
+	}
+}
+
+// mockOracle 是测试用的自定义预编译合约，总是返回固定的价格
+type mockOracle struct{}
+
+func (mockOracle) RequiredGas(input []byte) uint64 { return 42 }
+func (mockOracle) Run(input []byte) ([]byte, error) {
+	return common.BigToHash(big.NewInt(7)).Bytes(), nil
+}
+
+func TestPrecompileOverrides(t *testing.T) {
+	var (
+		oracle   = common.BytesToAddress([]byte{0x01, 0x00})
+		identity = common.BytesToAddress([]byte{4})
+		input    = []byte{1, 2, 3}
+	)
+	cfg := &Config{
+		State: NewState(nil),
+		EVMConfig: vm.Config{
+			Precompiles: map[common.Address]vm.PrecompiledContract{
+				oracle:   mockOracle{},
+				identity: nil,
+			},
+		},
+	}
+	ret, leftOverGas, err := Call(oracle, nil, cfg)
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	if have := new(big.Int).SetBytes(ret); have.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("oracle result mismatch: have %v, want 7", have)
+	}
+	if used := cfg.GasLimit - leftOverGas; used != 42 {
+		t.Errorf("oracle gas mismatch: have %d, want 42", used)
+	}
+	// 被禁用的内置合约就像一个空账户
+	if ret, _, err = Call(identity, input, cfg); err != nil || len(ret) != 0 {
+		t.Errorf("disabled identity: have %x, %v, want empty result", ret, err)
+	}
+	// 未覆盖时仍使用当前分叉的默认合约
+	if ret, _, err = Call(identity, input, &Config{State: NewState(nil)}); err != nil || !bytes.Equal(ret, input) {
+		t.Errorf("default identity: have %x, %v, want %x", ret, err, input)
+	}
+}
+
+func TestAllocRoundTrip(t *testing.T) {
+	address := common.HexToAddress("0x0b")
+	pre := GenesisAlloc{
+		address: {
+			Balance: math.NewHexOrDecimal256(10),
+			Nonce:   1,
+			// sstore(1, sload(0) + 1)
+			Code: []byte{
+				byte(vm.PUSH1), 0,
+				byte(vm.SLOAD),
+				byte(vm.PUSH1), 1,
+				byte(vm.ADD),
+				byte(vm.PUSH1), 1,
+				byte(vm.SSTORE),
+			},
+			Storage: map[common.Hash]common.Hash{
+				common.Hash{}: common.BigToHash(big.NewInt(41)),
+			},
+		},
+	}
+	cfg := &Config{State: NewState(pre)}
+	if _, _, err := Call(address, nil, cfg); err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	post, err := DumpAlloc(cfg.State, true)
+	if err != nil {
+		t.Fatal("failed to dump state", err)
+	}
+	// 通过文件写出再读回，结果应保持不变
+	path := filepath.Join(t.TempDir(), "post.json")
+	if err := WriteAlloc(path, post); err != nil {
+		t.Fatal("failed to write alloc", err)
+	}
+	if post, err = ReadAlloc(path); err != nil {
+		t.Fatal("failed to read alloc", err)
+	}
+	account, ok := post[address]
+	if !ok {
+		t.Fatalf("account %x missing from post state", address)
+	}
+	if (*big.Int)(account.Balance).Cmp(big.NewInt(10)) != 0 || account.Nonce != 1 {
+		t.Errorf("unexpected balance/nonce: %v/%d", (*big.Int)(account.Balance), account.Nonce)
+	}
+	if !bytes.Equal(account.Code, pre[address].Code) {
+		t.Errorf("code mismatch: have %x, want %x", account.Code, pre[address].Code)
+	}
+	if have, want := account.Storage[common.BigToHash(big.NewInt(1))], common.BigToHash(big.NewInt(42)); have != want {
+		t.Errorf("slot 1 mismatch: have %x, want %x", have, want)
+	}
+	if have, want := account.Storage[common.Hash{}], common.BigToHash(big.NewInt(41)); have != want {
+		t.Errorf("slot 0 mismatch: have %x, want %x", have, want)
+	}
+}
+
+func TestCallTracer(t *testing.T) {
+	address := common.HexToAddress("0x0b")
+	// call(gas, 0x04, 0, 0, 0, 0, 0)
+	code := []byte{
+		byte(vm.PUSH1), 0,
+		byte(vm.DUP1),
+		byte(vm.DUP1),
+		byte(vm.DUP1),
+		byte(vm.DUP1),
+		byte(vm.PUSH1), 4,
+		byte(vm.GAS),
+		byte(vm.CALL),
+	}
+	tracer := vm.NewCallTracer()
+	cfg := &Config{
+		State:     NewState(GenesisAlloc{address: {Code: code}}),
+		EVMConfig: vm.Config{Debug: true, Tracer: tracer},
+	}
+	if _, _, err := Call(address, nil, cfg); err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	root := tracer.Result()
+	if root.To != address || len(root.Calls) != 1 {
+		t.Fatalf("unexpected call tree: %+v", root)
+	}
+	if call := root.Calls[0]; call.Type != "CALL" || call.From != address || call.To != common.BytesToAddress([]byte{4}) {
+		t.Errorf("unexpected nested call: %+v", call)
+	}
+}
+
+func TestPrestateFixture(t *testing.T) {
+	address := common.HexToAddress("0x0b")
+	// mstore(0, sload(0) + selfbalance()); return(0, 32)
+	code := []byte{
+		byte(vm.PUSH1), 0,
+		byte(vm.SLOAD),
+		byte(vm.SELFBALANCE),
+		byte(vm.ADD),
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	}
+	pre := GenesisAlloc{
+		address: {
+			Balance: math.NewHexOrDecimal256(2),
+			Code:    code,
+			Storage: map[common.Hash]common.Hash{
+				common.Hash{}: common.BigToHash(big.NewInt(40)),
+			},
+		},
+		common.HexToAddress("0x0c"): {Balance: math.NewHexOrDecimal256(1)},
+	}
+	chainConfig, _ := ForkConfig("Istanbul")
+	statedb := NewState(pre)
+	tracer := vm.NewPrestateTracer(statedb, false)
+	cfg := &Config{
+		ChainConfig: chainConfig,
+		State:       statedb,
+		EVMConfig:   vm.Config{Debug: true, Tracer: tracer},
+	}
+	want, _, err := Call(address, nil, cfg)
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	blob, err := tracer.GetResult()
+	if err != nil {
+		t.Fatal("failed to encode prestate", err)
+	}
+	// 预状态应能直接作为alloc载入，并重现同样的结果
+	var fixture GenesisAlloc
+	if err := json.Unmarshal(blob, &fixture); err != nil {
+		t.Fatal("failed to decode prestate", err)
+	}
+	if _, ok := fixture[common.HexToAddress("0x0c")]; ok {
+		t.Error("untouched account in prestate")
+	}
+	ret, _, err := Call(address, nil, &Config{ChainConfig: chainConfig, State: NewState(fixture)})
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	if !bytes.Equal(ret, want) || new(big.Int).SetBytes(ret).Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("replay mismatch: have %x, want %x", ret, want)
+	}
+}
+
+func TestRevertReason(t *testing.T) {
+	definition := `[{"type":"error","name":"Unauthorized","inputs":[{"name":"caller","type":"address"}]}]`
+	contractABI, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mstore(0, Unauthorized.selector << 224); mstore(4, 0x0b); revert(0, 36)
+	selector := contractABI.Errors["Unauthorized"].Id()
+	code := append([]byte{byte(vm.PUSH4)}, selector...)
+	code = append(code,
+		byte(vm.PUSH1), 224,
+		byte(vm.SHL),
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x0b,
+		byte(vm.PUSH1), 4,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 36,
+		byte(vm.PUSH1), 0,
+		byte(vm.REVERT),
+	)
+	chainConfig, _ := ForkConfig("Constantinople")
+	_, _, err = Execute(code, nil, &Config{ChainConfig: chainConfig, EVMConfig: vm.Config{ErrorABI: &contractABI}})
+	revert, ok := err.(*vm.RevertError)
+	if !ok {
+		t.Fatalf("expected *vm.RevertError, have %T: %v", err, err)
+	}
+	if revert.ErrorName() != "Unauthorized" || revert.Args()[0] != common.HexToAddress("0x0b") {
+		t.Errorf("unexpected custom error: %v", revert)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	var (
+		address = common.HexToAddress("0x0b")
+		other   = common.HexToAddress("0x0c")
+	)
+	// balance(other); sstore(0, sload(0) + 1); blockhash(5); call(gas, other, 0, 0, 0, 0, 0)
+	// mstore(0, sload(0)); return(0, 32)
+	code := append([]byte{byte(vm.PUSH20)}, other.Bytes()...)
+	code = append(code,
+		byte(vm.BALANCE), byte(vm.POP),
+		byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.SSTORE),
+		byte(vm.PUSH1), 5, byte(vm.BLOCKHASH), byte(vm.POP),
+		byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.DUP1), byte(vm.DUP1), byte(vm.DUP1), byte(vm.PUSH20),
+	)
+	code = append(code, other.Bytes()...)
+	code = append(code,
+		byte(vm.GAS), byte(vm.CALL), byte(vm.POP),
+		byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 0, byte(vm.MSTORE),
+		byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN),
+	)
+	statedb := NewState(GenesisAlloc{
+		address: {
+			Balance: math.NewHexOrDecimal256(0),
+			Code:    code,
+			Storage: map[common.Hash]common.Hash{common.Hash{}: common.BigToHash(big.NewInt(7))},
+		},
+		// sload(1)
+		other: {
+			Balance: math.NewHexOrDecimal256(5),
+			Code:    []byte{byte(vm.PUSH1), 1, byte(vm.SLOAD), byte(vm.POP)},
+			Storage: map[common.Hash]common.Hash{common.BigToHash(big.NewInt(1)): common.BigToHash(big.NewInt(9))},
+		},
+		// 与执行无关的账户不应出现在轨迹中
+		common.HexToAddress("0x0d"): {Balance: math.NewHexOrDecimal256(1)},
+	})
+	chainConfig, _ := ForkConfig("London")
+	cfg := &Config{ChainConfig: chainConfig, State: statedb, BlockNumber: big.NewInt(10)}
+	ret, _, trace, err := Record(address, nil, cfg)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if new(big.Int).SetBytes(ret).Int64() != 8 {
+		t.Fatalf("unexpected return value %x", ret)
+	}
+	if len(trace.Accounts) != 3 || len(trace.Context.Hashes) != 1 || trace.Context.Hashes[0].Number != 5 {
+		t.Errorf("unexpected recorded inputs: %d accounts, hashes %v", len(trace.Accounts), trace.Context.Hashes)
+	}
+
+	var buf bytes.Buffer
+	if err := trace.Encode(&buf); err != nil {
+		t.Fatalf("failed to encode trace: %v", err)
+	}
+	decoded, err := vm.DecodeExecutionTrace(&buf)
+	if err != nil {
+		t.Fatalf("failed to decode trace: %v", err)
+	}
+	replay, err := Replay(decoded, vm.Config{})
+	if err != nil {
+		t.Fatalf("replay diverged: %v", err)
+	}
+	if len(replay.Steps) != len(trace.Steps) || !bytes.Equal(replay.Output, ret) {
+		t.Errorf("replay mismatch: %d steps, output %x", len(replay.Steps), replay.Output)
+	}
+
+	// 把存储槽0改为0，重放中的SSTORE变为新写入，gas消耗随之不同
+	for i, account := range decoded.Accounts {
+		if account.Address == address {
+			decoded.Accounts[i].Storage[0].Original = common.Hash{}
+			decoded.Accounts[i].Storage[0].Value = common.Hash{}
+		}
+	}
+	_, err = Replay(decoded, vm.Config{})
+	divergence, ok := err.(*vm.TraceDivergence)
+	if !ok {
+		t.Fatalf("expected *vm.TraceDivergence, have %T: %v", err, err)
+	}
+	if divergence.Step < 0 || divergence.Field != "cost" || trace.Steps[divergence.Step].Op != vm.SSTORE {
+		t.Errorf("unexpected divergence: %v", divergence)
+	}
+}
+
 func BenchmarkCall(b *testing.B) {
 	var definition = `[{"constant":true,"inputs":[],"name":"seller","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"abort","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"value","outputs":[{"name":"","type":"uint256"}],"type":"function"},{"constant":false,"inputs":[],"name":"refund","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"buyer","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmReceived","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"state","outputs":[{"name":"","type":"uint8"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmPurchase","outputs":[],"type":"function"},{"inputs":[],"type":"constructor"},{"anonymous":false,"inputs":[],"name":"Aborted","type":"event"},{"anonymous":false,"inputs":[],"name":"PurchaseConfirmed","type":"event"},{"anonymous":false,"inputs":[],"name":"ItemReceived","type":"event"},{"anonymous":false,"inputs":[],"name":"Refunded","type":"event"}]`
 
@@ -187,3 +697,671 @@ func BenchmarkEVM_CREATE2_1200(bench *testing.B) {
 	// 初始化code大小1200K，反复调用CREATE2，然后修改mem内容
 	benchmarkEVM_Create(bench, "5b5862124f80600080f5600152600056")
 }
+
+func TestDatadir(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		address = common.HexToAddress("0x0b")
+		// sstore(0, sload(0) + 1)
+		code = []byte{byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.SSTORE)}
+	)
+	// 每次执行都重新打开数据目录，第一次执行时部署合约，之后的执行只调用它
+	for i := 1; i <= 3; i++ {
+		datadir, err := OpenDatadir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statedb, err := datadir.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			if datadir.Root() != (common.Hash{}) {
+				t.Fatalf("fresh datadir has root %x", datadir.Root())
+			}
+			statedb.SetCode(address, code)
+			statedb.SetBalance(address, big.NewInt(100))
+		}
+		if _, _, err := Call(address, nil, &Config{State: statedb}); err != nil {
+			t.Fatalf("run %d: call failed: %v", i, err)
+		}
+		root, err := datadir.Commit(statedb, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := datadir.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		reopened, err := OpenDatadir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reopened.Root() != root {
+			t.Errorf("run %d: head root mismatch: have %x, want %x", i, reopened.Root(), root)
+		}
+		statedb, err = reopened.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value := statedb.GetState(address, common.Hash{}); value != common.BigToHash(big.NewInt(int64(i))) {
+			t.Errorf("run %d: counter mismatch: have %x", i, value)
+		}
+		if !bytes.Equal(statedb.GetCode(address), code) || statedb.GetBalance(address).Int64() != 100 {
+			t.Errorf("run %d: account not persisted", i)
+		}
+		reopened.Close()
+	}
+}
+
+// remoteStandIn 是用固定内容应答JSON-RPC请求的本地HTTP服务，应答以"方法 参数..."为键，
+// 并统计收到的请求
+type remoteStandIn struct {
+	responses map[string]string
+	requests  []string
+}
+
+func (s *remoteStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []string        `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := strings.Join(append([]string{req.Method}, req.Params...), " ")
+	s.requests = append(s.requests, key)
+	if result, ok := s.responses[key]; ok {
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, result)
+		return
+	}
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32000,"message":"unexpected request"}}`, req.ID)
+}
+
+func TestRemoteState(t *testing.T) {
+	var (
+		address = common.HexToAddress("0x0b")
+		origin  = common.HexToAddress("0x0a")
+		// sstore(0, 5); mstore(0, sload(1)); return(0, 32)
+		code = []byte{
+			byte(vm.PUSH1), 5, byte(vm.PUSH1), 0, byte(vm.SSTORE),
+			byte(vm.PUSH1), 1, byte(vm.SLOAD), byte(vm.PUSH1), 0, byte(vm.MSTORE),
+			byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN),
+		}
+		slot0 = "0x0000000000000000000000000000000000000000000000000000000000000000"
+		slot1 = "0x0000000000000000000000000000000000000000000000000000000000000001"
+		slot2 = "0x0000000000000000000000000000000000000000000000000000000000000002"
+	)
+	standIn := &remoteStandIn{responses: map[string]string{
+		"eth_blockNumber": `"0x10"`,
+		"eth_getBalance 0x000000000000000000000000000000000000000b 0x10":                 `"0x64"`,
+		"eth_getTransactionCount 0x000000000000000000000000000000000000000b 0x10":        `"0x1"`,
+		"eth_getCode 0x000000000000000000000000000000000000000b 0x10":                    fmt.Sprintf(`"0x%x"`, code),
+		"eth_getStorageAt 0x000000000000000000000000000000000000000b " + slot0 + " 0x10": `"0x0000000000000000000000000000000000000000000000000000000000000007"`,
+		"eth_getStorageAt 0x000000000000000000000000000000000000000b " + slot1 + " 0x10": `"0x000000000000000000000000000000000000000000000000000000000000002a"`,
+		"eth_getStorageAt 0x000000000000000000000000000000000000000b " + slot2 + " 0x10": `"0x0000000000000000000000000000000000000000000000000000000000000005"`,
+		"eth_getBalance 0x000000000000000000000000000000000000000a 0x10":                 `"0x0"`,
+		"eth_getTransactionCount 0x000000000000000000000000000000000000000a 0x10":        `"0x0"`,
+		"eth_getCode 0x000000000000000000000000000000000000000a 0x10":                    `"0x"`,
+		"eth_getBalance 0x000000000000000000000000000000000000000d 0x10":                 `"0x64"`,
+		"eth_getTransactionCount 0x000000000000000000000000000000000000000d 0x10":        `"0x0"`,
+		"eth_getCode 0x000000000000000000000000000000000000000d 0x10":                    `"0x"`,
+		// selfdestruct(0)
+		"eth_getBalance 0x000000000000000000000000000000000000000e 0x10":                 `"0x0"`,
+		"eth_getTransactionCount 0x000000000000000000000000000000000000000e 0x10":        `"0x0"`,
+		"eth_getCode 0x000000000000000000000000000000000000000e 0x10":                    `"0x6000ff"`,
+		"eth_getStorageAt 0x000000000000000000000000000000000000000e " + slot1 + " 0x10": `"0x000000000000000000000000000000000000000000000000000000000000002a"`,
+	}}
+	// 起始账户第一次CREATE的地址在远程节点上有余额和存储
+	created := crypto.CreateAddress(origin, 0)
+	standIn.responses[fmt.Sprintf("eth_getBalance 0x%x 0x10", created)] = `"0x64"`
+	standIn.responses[fmt.Sprintf("eth_getTransactionCount 0x%x 0x10", created)] = `"0x0"`
+	standIn.responses[fmt.Sprintf("eth_getCode 0x%x 0x10", created)] = `"0x"`
+	standIn.responses[fmt.Sprintf("eth_getStorageAt 0x%x %s 0x10", created, slot1)] = `"0x000000000000000000000000000000000000000000000000000000000000002a"`
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	backend, err := state.NewRPCBackend(server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.Block() != 0x10 {
+		t.Fatalf("pinned block mismatch: have %d, want 16", backend.Block())
+	}
+	var (
+		diskdb     = rawdb.NewMemoryDatabase()
+		remotedb   = state.NewRemoteDatabase(diskdb, backend)
+		statedb, _ = state.New(common.Hash{}, remotedb)
+	)
+	ret, _, err := Call(address, nil, &Config{State: statedb, Origin: origin})
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if err := statedb.Error(); err != nil {
+		t.Fatalf("state error: %v", err)
+	}
+	if new(big.Int).SetBytes(ret).Int64() != 42 {
+		t.Errorf("unexpected return value %x", ret)
+	}
+	if statedb.GetBalance(address).Int64() != 100 || statedb.GetNonce(address) != 1 {
+		t.Errorf("remote accounts mismatch")
+	}
+	if value := statedb.GetState(address, common.Hash{}); value != common.BigToHash(big.NewInt(5)) {
+		t.Errorf("local write lost: have %x", value)
+	}
+	if value := statedb.GetCommittedState(address, common.Hash{}); value != common.BigToHash(big.NewInt(7)) {
+		t.Errorf("committed remote value mismatch: have %x", value)
+	}
+	// 提交后的状态根只覆盖本地的改动，在其上打开的状态仍然可以读到远程的值
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb, _ = state.New(root, remotedb)
+	if statedb.GetState(address, common.Hash{}) != common.BigToHash(big.NewInt(5)) || statedb.GetState(address, common.BigToHash(big.NewInt(1))) != common.BigToHash(big.NewInt(42)) {
+		t.Errorf("committed state mismatch")
+	}
+	fetched := len(standIn.requests)
+
+	// 同一个本地数据库上的新状态从缓存中读取，不再访问远程节点
+	statedb, _ = state.New(common.Hash{}, state.NewRemoteDatabase(diskdb, backend))
+	if ret, _, err := Call(address, nil, &Config{State: statedb, Origin: origin}); err != nil || new(big.Int).SetBytes(ret).Int64() != 42 {
+		t.Errorf("cached call failed: %x, %v", ret, err)
+	}
+	if len(standIn.requests) != fetched {
+		t.Errorf("cached state hit the remote: %v", standIn.requests[fetched:])
+	}
+
+	// 在新的远程数据库上打开写入磁盘的状态根，本地存在的账户的远程存储仍然可以读取
+	if err := remotedb.TrieDB().Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+	if statedb, err = state.New(root, state.NewRemoteDatabase(diskdb, backend)); err != nil {
+		t.Fatal(err)
+	}
+	if value := statedb.GetState(address, common.BigToHash(big.NewInt(1))); value != common.BigToHash(big.NewInt(42)) {
+		t.Errorf("cached slot of committed account mismatch: have %x", value)
+	}
+	if len(standIn.requests) != fetched {
+		t.Errorf("cached slot of committed account hit the remote: %v", standIn.requests[fetched:])
+	}
+	if value := statedb.GetState(address, common.BigToHash(big.NewInt(2))); value != common.BigToHash(big.NewInt(5)) {
+		t.Errorf("remote slot of committed account mismatch: have %x", value)
+	}
+	if err := statedb.Error(); err != nil {
+		t.Errorf("state error: %v", err)
+	}
+
+	// 本地删除的存储槽和自毁的账户在提交并重新打开后不会重新读到远程的值，
+	// 删除之前提交的状态仍然可以读到
+	reopen := func(statedb *state.StateDB, deleteEmptyObjects bool) *state.StateDB {
+		t.Helper()
+		root, err := statedb.Commit(deleteEmptyObjects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := statedb.Database().TrieDB().Commit(root, false); err != nil {
+			t.Fatal(err)
+		}
+		reopened, err := state.New(root, state.NewRemoteDatabase(diskdb, backend))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reopened
+	}
+	statedb.SetState(address, common.BigToHash(big.NewInt(1)), common.Hash{})
+	statedb = reopen(statedb, true)
+	if value := statedb.GetState(address, common.BigToHash(big.NewInt(1))); value != (common.Hash{}) {
+		t.Errorf("deleted slot mismatch: have %x", value)
+	}
+	if value := statedb.GetState(address, common.BigToHash(big.NewInt(2))); value != common.BigToHash(big.NewInt(5)) {
+		t.Errorf("untouched slot mismatch: have %x", value)
+	}
+	statedb.Suicide(address)
+	statedb = reopen(statedb, true)
+	if statedb.Exist(address) {
+		t.Errorf("self-destructed account exists after reopening")
+	}
+
+	// 不删除空账户时写入的空账户不会被当作本地删除的账户，遍历时也不会出现墓碑
+	empty := common.HexToAddress("0x0d")
+	statedb.CreateAccount(empty)
+	statedb.SetBalance(empty, new(big.Int))
+	statedb = reopen(statedb, false)
+	if !statedb.Exist(empty) || statedb.GetBalance(empty).Sign() != 0 {
+		t.Errorf("empty account mismatch: exists %v, balance %v", statedb.Exist(empty), statedb.GetBalance(empty))
+	}
+	dump := statedb.RawDump(false, false, false)
+	if _, ok := dump.Accounts[empty]; !ok || len(dump.Accounts) != 1 {
+		t.Errorf("unexpected dumped accounts %v", dump.Accounts)
+	}
+
+	if statedb, err = state.New(root, state.NewRemoteDatabase(diskdb, backend)); err != nil {
+		t.Fatal(err)
+	}
+	if !statedb.Exist(address) || statedb.GetState(address, common.BigToHash(big.NewInt(1))) != common.BigToHash(big.NewInt(42)) {
+		t.Errorf("deletion leaked into an earlier state")
+	}
+
+	// 自毁后重新创建的账户和CREATE覆盖的远程账户不再读取远程的存储，提交并重新打开后也是如此
+	destructed := common.HexToAddress("0x0e")
+	statedb, _ = state.New(common.Hash{}, state.NewRemoteDatabase(diskdb, backend))
+	if _, _, err := Call(destructed, nil, &Config{State: statedb, Origin: origin}); err != nil {
+		t.Fatalf("selfdestruct call failed: %v", err)
+	}
+	statedb.Finalise(true)
+	statedb.IntermediateRoot(true)
+	if statedb.Exist(destructed) {
+		t.Errorf("self-destructed account exists")
+	}
+	statedb.CreateAccount(destructed)
+	// sstore(2, sload(1) + 1)
+	initcode := []byte{byte(vm.PUSH1), 1, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 2, byte(vm.SSTORE)}
+	if _, addr, _, err := Create(initcode, &Config{State: statedb, Origin: origin}); err != nil || addr != created {
+		t.Fatalf("create failed: %x, %v", addr, err)
+	}
+	check := func(statedb *state.StateDB) {
+		t.Helper()
+		if value := statedb.GetState(destructed, common.BigToHash(big.NewInt(1))); value != (common.Hash{}) {
+			t.Errorf("recreated account reads remote storage: have %x", value)
+		}
+		if value := statedb.GetState(created, common.BigToHash(big.NewInt(1))); value != (common.Hash{}) {
+			t.Errorf("created account reads remote storage: have %x", value)
+		}
+		if value := statedb.GetState(created, common.BigToHash(big.NewInt(2))); value != common.BigToHash(big.NewInt(1)) {
+			t.Errorf("init code read remote storage: have %x", value)
+		}
+		if statedb.GetBalance(created).Int64() != 100 {
+			t.Errorf("created account balance mismatch: have %v", statedb.GetBalance(created))
+		}
+	}
+	check(statedb)
+	check(reopen(statedb, true))
+
+	// 远程节点的错误通过 StateDB.Error 报告
+	statedb, _ = state.New(common.Hash{}, state.NewRemoteDatabase(rawdb.NewMemoryDatabase(), backend))
+	if statedb.Exist(common.HexToAddress("0x0c")) {
+		t.Errorf("failed fetch reported an existing account")
+	}
+	if err := statedb.Error(); err == nil || !strings.Contains(err.Error(), "unexpected request") {
+		t.Errorf("unexpected state error: %v", err)
+	}
+}
+
+func TestRemoteDatadir(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		address = common.HexToAddress("0x0b")
+		// sstore(0, sload(0) + 1)
+		code = []byte{byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.SSTORE)}
+	)
+	standIn := &remoteStandIn{responses: map[string]string{
+		"eth_getBalance 0x000000000000000000000000000000000000000b 0x10":                                                                      `"0x64"`,
+		"eth_getTransactionCount 0x000000000000000000000000000000000000000b 0x10":                                                             `"0x1"`,
+		"eth_getCode 0x000000000000000000000000000000000000000b 0x10":                                                                         fmt.Sprintf(`"0x%x"`, code),
+		"eth_getStorageAt 0x000000000000000000000000000000000000000b 0x0000000000000000000000000000000000000000000000000000000000000000 0x10": `"0x0000000000000000000000000000000000000000000000000000000000000007"`,
+	}}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	backend := func(block int64) state.RemoteBackend {
+		t.Helper()
+		backend, err := state.NewRPCBackend(server.URL, big.NewInt(block))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return backend
+	}
+	// 每次执行都重新打开数据目录，远程的数据只在第一次执行时获取
+	for i := 1; i <= 3; i++ {
+		datadir, err := OpenDatadir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := datadir.UseRemote(backend(0x10)); err != nil {
+			t.Fatal(err)
+		}
+		statedb, err := datadir.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Call(address, nil, &Config{State: statedb, Origin: address}); err != nil {
+			t.Fatalf("run %d: call failed: %v", i, err)
+		}
+		if err := statedb.Error(); err != nil {
+			t.Fatalf("run %d: state error: %v", i, err)
+		}
+		if value := statedb.GetState(address, common.Hash{}); value != common.BigToHash(big.NewInt(int64(7+i))) {
+			t.Errorf("run %d: counter mismatch: have %x", i, value)
+		}
+		if _, err := datadir.Commit(statedb, true); err != nil {
+			t.Fatal(err)
+		}
+		datadir.Close()
+	}
+	if len(standIn.requests) != 4 {
+		t.Errorf("cached data fetched again: %v", standIn.requests)
+	}
+
+	// 数据目录中的状态不会被用于其他区块，也不能离开远程节点使用
+	datadir, err := OpenDatadir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer datadir.Close()
+	if block, ok := datadir.RemoteBlock(); !ok || block != 0x10 {
+		t.Errorf("remote block mismatch: have %d, %v", block, ok)
+	}
+	if _, err := datadir.State(); err == nil {
+		t.Error("expected error for remote state without a backend")
+	}
+	if err := datadir.UseRemote(backend(0x11)); err == nil {
+		t.Error("expected error for a different remote block")
+	}
+	local, err := OpenDatadir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	if _, err := local.Commit(NewState(GenesisAlloc{address: {Balance: math.NewHexOrDecimal256(1)}}), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.UseRemote(backend(0x10)); err == nil {
+		t.Error("expected error for a local state")
+	}
+}
+
+func TestStateDiff(t *testing.T) {
+	var (
+		address = common.HexToAddress("0x0b")
+		removed = common.HexToAddress("0x0c")
+		origin  = common.HexToAddress("0x0a")
+	)
+	// sstore(1, sload(1) + 1); sstore(2, 0); sstore(5, 9)
+	code := []byte{
+		byte(vm.PUSH1), 1, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 1, byte(vm.SSTORE),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 2, byte(vm.SSTORE),
+		byte(vm.PUSH1), 9, byte(vm.PUSH1), 5, byte(vm.SSTORE),
+	}
+	statedb := NewState(GenesisAlloc{
+		address: {
+			Balance: math.NewHexOrDecimal256(0),
+			Code:    code,
+			Storage: map[common.Hash]common.Hash{
+				common.BigToHash(big.NewInt(1)): common.BigToHash(big.NewInt(1)),
+				common.BigToHash(big.NewInt(2)): common.BigToHash(big.NewInt(7)),
+				common.BigToHash(big.NewInt(3)): common.BigToHash(big.NewInt(3)),
+			},
+		},
+		origin:  {Balance: math.NewHexOrDecimal256(100)},
+		removed: {Balance: math.NewHexOrDecimal256(1)},
+		// 不变的账户不出现在结果中
+		common.HexToAddress("0x0d"): {Balance: math.NewHexOrDecimal256(1), Nonce: 1},
+	})
+	before, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Call(address, nil, &Config{State: statedb, Origin: origin, Value: big.NewInt(10)}); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	statedb.Suicide(removed)
+	statedb.SetNonce(origin, 1)
+	created := common.HexToAddress("0x0e")
+	statedb.SetCode(created, []byte{byte(vm.STOP)})
+	after, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := state.Diff(statedb.Database(), before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[common.Address]*state.AccountDiff)
+	for _, diff := range diffs {
+		got[diff.Address] = diff
+	}
+	if len(diffs) != 4 || len(got) != 4 {
+		t.Fatalf("unexpected diff count %d: %v", len(diffs), diffs)
+	}
+	if diff := got[origin]; diff.PrevBalance.Int64() != 100 || diff.Balance.Int64() != 90 || diff.PrevNonce != 0 || diff.Nonce != 1 || len(diff.Storage) != 0 {
+		t.Errorf("origin diff mismatch: %v", diff)
+	}
+	if diff := got[removed]; !diff.Deleted || diff.PrevBalance.Int64() != 1 || diff.Balance.Sign() != 0 {
+		t.Errorf("removed diff mismatch: %v", diff)
+	}
+	if diff := got[created]; !diff.Created || diff.PrevCodeHash != crypto.Keccak256Hash(nil) || diff.CodeHash != crypto.Keccak256Hash([]byte{byte(vm.STOP)}) {
+		t.Errorf("created diff mismatch: %v", diff)
+	}
+	want := []state.StorageDiff{
+		{Key: common.BigToHash(big.NewInt(1)), Prev: common.BigToHash(big.NewInt(1)), Value: common.BigToHash(big.NewInt(2))},
+		{Key: common.BigToHash(big.NewInt(2)), Prev: common.BigToHash(big.NewInt(7))},
+		{Key: common.BigToHash(big.NewInt(5)), Value: common.BigToHash(big.NewInt(9))},
+	}
+	diff := got[address]
+	if diff.Created || diff.Deleted || diff.Balance.Int64() != 10 || len(diff.Storage) != len(want) {
+		t.Fatalf("contract diff mismatch: %v", diff)
+	}
+	for _, slot := range diff.Storage {
+		found := false
+		for _, w := range want {
+			if w.Key == slot.Key {
+				found = slot.KeyHash == crypto.Keccak256Hash(w.Key[:]) && slot.Prev == w.Prev && slot.Value == w.Value
+			}
+		}
+		if !found {
+			t.Errorf("unexpected storage diff %+v", slot)
+		}
+	}
+	if s := diff.String(); !strings.Contains(s, "storage 0000000000000000000000000000000000000000000000000000000000000005: 0000000000000000000000000000000000000000000000000000000000000000 -> 0000000000000000000000000000000000000000000000000000000000000009") {
+		t.Errorf("unexpected rendering:\n%s", s)
+	}
+	if diffs, err := state.Diff(statedb.Database(), after, after); err != nil || len(diffs) != 0 {
+		t.Errorf("diff of identical roots: %v, %v", diffs, err)
+	}
+	// 从空状态开始的差异包含所有仍然存在的账户
+	if diffs, err := state.Diff(statedb.Database(), common.Hash{}, after); err != nil || len(diffs) != 4 {
+		t.Errorf("diff from empty state: %v, %v", diffs, err)
+	}
+}
+
+func TestStateChanges(t *testing.T) {
+	var (
+		address = common.HexToAddress("0x0b")
+		origin  = common.HexToAddress("0x0a")
+		one     = common.BigToHash(big.NewInt(1))
+	)
+	// sstore(1, 5); sstore(1, 6); tstore(1, 7)
+	code := []byte{
+		byte(vm.PUSH1), 5, byte(vm.PUSH1), 1, byte(vm.SSTORE),
+		byte(vm.PUSH1), 6, byte(vm.PUSH1), 1, byte(vm.SSTORE),
+		byte(vm.PUSH1), 7, byte(vm.PUSH1), 1, byte(vm.TSTORE),
+	}
+	statedb := NewState(GenesisAlloc{
+		address: {Balance: math.NewHexOrDecimal256(0), Code: code},
+		origin:  {Balance: math.NewHexOrDecimal256(100)},
+	})
+	if _, err := statedb.Commit(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Call(address, nil, &Config{ChainConfig: Forks["Cancun"], State: statedb, Origin: origin, Value: big.NewInt(10)}); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	var storage, transient []state.StateChange
+	for _, change := range statedb.Changes() {
+		switch change.Field {
+		case state.ChangeStorage:
+			storage = append(storage, change)
+		case state.ChangeTransientStorage:
+			transient = append(transient, change)
+		case state.ChangeBalance:
+			if change.Address == address && (change.Prev.(*big.Int).Sign() != 0 || change.New.(*big.Int).Int64() != 10) {
+				t.Errorf("unexpected balance change %v", change)
+			}
+		}
+	}
+	if len(storage) != 2 || storage[0].Key != one || storage[0].Prev != (common.Hash{}) || storage[0].New != common.BigToHash(big.NewInt(5)) ||
+		storage[1].Prev != common.BigToHash(big.NewInt(5)) || storage[1].New != common.BigToHash(big.NewInt(6)) || storage[0].Snapshot != storage[1].Snapshot {
+		t.Errorf("unexpected storage changes %v", storage)
+	}
+	// 瞬时存储在执行结束后被清空，改动记录中仍保留写入的值
+	if len(transient) != 1 || transient[0].New != common.BigToHash(big.NewInt(7)) {
+		t.Errorf("unexpected transient storage changes %v", transient)
+	}
+
+	snap := statedb.Snapshot()
+	statedb.SetNonce(origin, 5)
+	statedb.Suicide(address)
+	changes, err := statedb.ChangesSince(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		fmt.Sprintf("[%d] %x nonce: 0 -> 5", snap, origin),
+		fmt.Sprintf("[%d] %x suicide: false -> true", snap, address),
+		fmt.Sprintf("[%d] %x balance: 10 -> 0", snap, address),
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("unexpected changes since snapshot %v", changes)
+	}
+	for i, change := range changes {
+		if change.String() != want[i] {
+			t.Errorf("change %d mismatch: have %v, want %v", i, change, want[i])
+		}
+	}
+	total := len(statedb.Changes())
+	statedb.RevertToSnapshot(snap)
+	if n := len(statedb.Changes()); n != total-len(want) {
+		t.Errorf("reverted changes still reported: %d of %d", n, total)
+	}
+	if _, err := statedb.ChangesSince(snap); err == nil {
+		t.Error("expected error for reverted snapshot")
+	}
+	// 未开启记录时Finalise清空日志，开启后日志保留到ResetChanges
+	statedb.Finalise(true)
+	if changes := statedb.Changes(); len(changes) != 0 {
+		t.Errorf("changes reported after finalise: %v", changes)
+	}
+	statedb.RecordChanges(true)
+	statedb.SetNonce(origin, 9)
+	statedb.Finalise(true)
+	statedb.IntermediateRoot(true)
+	if changes := statedb.Changes(); len(changes) != 1 || changes[0].String() != fmt.Sprintf("[-1] %x nonce: 0 -> 9", origin) {
+		t.Errorf("recorded changes mismatch: %v", changes)
+	}
+	statedb.ResetChanges()
+	if changes := statedb.Changes(); len(changes) != 0 {
+		t.Errorf("changes reported after reset: %v", changes)
+	}
+
+	// Reset 丢弃的日志仍记录在当时的交易下
+	txhash := common.HexToHash("0x01")
+	statedb.Prepare(txhash, common.Hash{}, 0)
+	statedb.SetNonce(origin, 10)
+	if err := statedb.Reset(common.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	if changes := statedb.TxChanges(txhash); len(changes) != 1 || changes[0].String() != fmt.Sprintf("[-1] %x nonce: 9 -> 10", origin) {
+		t.Errorf("changes of reset transaction mismatch: %v", changes)
+	}
+	if changes := statedb.TxChanges(common.Hash{}); len(changes) != 0 {
+		t.Errorf("changes of reset transaction filed under the zero hash: %v", changes)
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	address := common.HexToAddress("0x0b")
+	// sstore(0, sload(0) + 1)
+	code := []byte{
+		byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.SSTORE),
+	}
+	cfg := &Config{State: NewState(GenesisAlloc{address: {Code: code}})}
+	count := func(statedb *state.StateDB) int64 {
+		return statedb.GetState(address, common.Hash{}).Big().Int64()
+	}
+	call := func() {
+		if _, _, err := Call(address, nil, cfg); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+	}
+	statedb := cfg.State
+	checkpoints := state.NewCheckpoints(statedb)
+
+	call()
+	checkpoints.Save("one")
+	rootOne := statedb.Copy().IntermediateRoot(true)
+	call()
+	statedb.IntermediateRoot(true)
+	checkpoints.Save("two")
+	call()
+	if _, err := statedb.Commit(true); err != nil {
+		t.Fatal(err)
+	}
+	if count(statedb) != 3 {
+		t.Fatalf("counter mismatch: have %d, want 3", count(statedb))
+	}
+
+	// 回到较晚的保存点后仍然可以回到更早的保存点
+	if err := checkpoints.Revert("two"); err != nil {
+		t.Fatal(err)
+	}
+	if count(statedb) != 2 {
+		t.Errorf("counter after revert to two: have %d, want 2", count(statedb))
+	}
+	if err := checkpoints.Revert("one"); err != nil {
+		t.Fatal(err)
+	}
+	if count(statedb) != 1 {
+		t.Errorf("counter after revert to one: have %d, want 1", count(statedb))
+	}
+	if root := statedb.IntermediateRoot(true); root != rootOne {
+		t.Errorf("root after revert mismatch: have %x, want %x", root, rootOne)
+	}
+	if names := checkpoints.Names(); len(names) != 1 || names[0] != "one" {
+		t.Errorf("unexpected savepoints %v", names)
+	}
+	if err := checkpoints.Revert("two"); err == nil {
+		t.Error("expected error for discarded savepoint")
+	}
+
+	// 分支之间互不影响
+	fork, err := checkpoints.Fork("one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, _, err := Call(address, nil, &Config{State: fork}); err != nil {
+			t.Fatalf("call on fork failed: %v", err)
+		}
+	}
+	call()
+	if count(fork) != 6 || count(statedb) != 2 {
+		t.Errorf("fork not independent: fork %d, state %d", count(fork), count(statedb))
+	}
+	if err := checkpoints.Revert("one"); err != nil {
+		t.Fatal(err)
+	}
+	if count(statedb) != 1 || count(fork) != 6 {
+		t.Errorf("revert affected fork: fork %d, state %d", count(fork), count(statedb))
+	}
+
+	// 重复使用名字只替换该保存点，之后的保存点保留
+	checkpoints.Save("two")
+	call()
+	checkpoints.Save("one")
+	if names := checkpoints.Names(); len(names) != 2 || names[0] != "two" || names[1] != "one" {
+		t.Errorf("unexpected savepoints after resave %v", names)
+	}
+	if err := checkpoints.Revert("two"); err != nil {
+		t.Fatal(err)
+	}
+	if count(statedb) != 1 {
+		t.Errorf("counter after revert to two: have %d, want 1", count(statedb))
+	}
+	if err := checkpoints.Release("two"); err != nil || len(checkpoints.Names()) != 0 {
+		t.Errorf("release failed: %v, %v", err, checkpoints.Names())
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"CuteEVM01"
+)
+
+// StateTestResult 是一个子测试的执行结果
+type StateTestResult struct {
+	File    string
+	Name    string
+	Fork    string
+	Index   int
+	Skipped bool  // 分叉不受支持，没有执行
+	Err     error // 执行失败或结果与期望不一致，通过时为nil
+}
+
+// Passed 报告子测试是否执行并通过
+func (r StateTestResult) Passed() bool {
+	return !r.Skipped && r.Err == nil
+}
+
+func (r StateTestResult) String() string {
+	id := fmt.Sprintf("%s/%s/%d", r.Name, r.Fork, r.Index)
+	switch {
+	case r.Skipped:
+		return fmt.Sprintf("SKIP %s: %v", id, r.Err)
+	case r.Err != nil:
+		return fmt.Sprintf("FAIL %s: %v", id, r.Err)
+	}
+	return "PASS " + id
+}
+
+// RunStateTests 执行给定文件，或给定目录下(递归)所有JSON文件中的状态测试，
+// 按文件、测试名称、分叉和下标的顺序返回每个子测试的结果
+func RunStateTests(path string, vmconfig vm.Config) ([]StateTestResult, error) {
+	var files []string
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".json") {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var results []StateTestResult
+	for _, file := range files {
+		fileResults, err := runStateTestFile(file, vmconfig)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		results = append(results, fileResults...)
+	}
+	return results, nil
+}
+
+// runStateTestFile 执行一个测试文件中的所有状态测试
+func runStateTestFile(file string, vmconfig vm.Config) ([]StateTestResult, error) {
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var tests map[string]*StateTest
+	if err := json.Unmarshal(blob, &tests); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results []StateTestResult
+	for _, name := range names {
+		test := tests[name]
+		for _, subtest := range test.Subtests() {
+			result := StateTestResult{File: file, Name: name, Fork: subtest.Fork, Index: subtest.Index}
+			result.Err = runSubtest(test, subtest, vmconfig)
+			if _, ok := result.Err.(UnsupportedForkError); ok {
+				result.Skipped = true
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// runSubtest 执行一个子测试，执行中的panic作为失败报告，以免中断整个测试集
+func runSubtest(test *StateTest, subtest StateSubtest, vmconfig vm.Config) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	_, err = test.Run(subtest, vmconfig)
+	return err
+}
+
+// sortSubtests 按分叉名称和下标排序子测试
+func sortSubtests(subtests []StateSubtest) {
+	sort.Slice(subtests, func(i, j int) bool {
+		if subtests[i].Fork != subtests[j].Fork {
+			return subtests[i].Fork < subtests[j].Fork
+		}
+		return subtests[i].Index < subtests[j].Index
+	})
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"CuteEVM01"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/crypto"
+	"CuteEVM01/Out/rlp"
+	"CuteEVM01/Out/trie"
+)
+
+// stateTestDir 是本地的测试向量目录，官方的 GeneralStateTests 文件可以直接放入其中
+var stateTestDir = filepath.Join("testdata", "GeneralStateTests")
+
+// allocRoot 不经过 StateDB，直接用安全trie计算给定账户集合的状态根，
+// 用于独立地验证测试向量中的期望状态根
+func allocRoot(t *testing.T, alloc stAlloc) common.Hash {
+	db := trie.NewDatabase(rawdb.NewMemoryDatabase())
+	accounts, _ := trie.NewSecure(common.Hash{}, db)
+	for addr, account := range alloc {
+		storage, _ := trie.NewSecure(common.Hash{}, db)
+		for key, value := range account.Storage {
+			if common.Hash(value) == (common.Hash{}) {
+				continue
+			}
+			blob, _ := rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
+			storage.Update(key[:], blob)
+		}
+		balance := new(big.Int)
+		if account.Balance != nil {
+			balance = (*big.Int)(account.Balance)
+		}
+		blob, err := rlp.EncodeToBytes(state.Account{
+			Nonce:    uint64(account.Nonce),
+			Balance:  balance,
+			Root:     storage.Hash(),
+			CodeHash: crypto.Keccak256(account.Code),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts.Update(addr[:], blob)
+	}
+	return accounts.Hash()
+}
+
+func TestStateTests(t *testing.T) {
+	results, err := RunStateTests(stateTestDir, vm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var passed, skipped int
+	for _, result := range results {
+		switch {
+		case result.Passed():
+			passed++
+		case result.Skipped:
+			skipped++
+		default:
+			t.Error(result)
+		}
+	}
+	if passed != 5 || skipped != 1 {
+		t.Errorf("result count mismatch: %d passed, %d skipped, want 5 and 1", passed, skipped)
+	}
+}
+
+// TestStateTestVectors 独立地检查测试向量本身: 期望的状态根与手工给出的后状态一致，
+// 日志哈希与手工编码的日志一致，私钥对应的发送者是约定的地址
+func TestStateTestVectors(t *testing.T) {
+	for _, file := range []string{"valueTransfer", "logAndStore"} {
+		test := loadStateTest(t, "stExample/"+file+".json", file)
+		for fork, posts := range test.Post {
+			for i, post := range posts {
+				if len(post.State) == 0 {
+					t.Errorf("%s/%s/%d: missing post state", file, fork, i)
+				}
+				if root := allocRoot(t, post.State); root != post.Root {
+					t.Errorf("%s/%s/%d: root mismatch: have %x, want %x", file, fork, i, root, post.Root)
+				}
+			}
+		}
+	}
+	// log0(0, 32) 以 mstore(0, 0x2a) 写入的内存为数据，没有主题
+	logs, err := rlp.EncodeToBytes([]interface{}{
+		[]interface{}{common.HexToAddress("0x095e7baea6a6c7c4c2dfeb977efac326af552d87"), []common.Hash{}, common.LeftPadBytes([]byte{0x2a}, 32)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fork, posts := range loadStateTest(t, "stExample/logAndStore.json", "logAndStore").Post {
+		if hash := crypto.Keccak256Hash(logs); posts[0].Logs != hash {
+			t.Errorf("logAndStore/%s: logs hash mismatch: have %x, want %x", fork, posts[0].Logs, hash)
+		}
+	}
+
+	test := loadStateTest(t, "stExample/valueTransfer.json", "valueTransfer")
+	msg, err := test.Transaction.toMessage(test.Post["London"][0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := common.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"); msg.From() != want {
+		t.Errorf("sender mismatch: have %x, want %x", msg.From(), want)
+	}
+}
+
+func TestStateTestMismatch(t *testing.T) {
+	test := loadStateTest(t, "stExample/valueTransfer.json", "valueTransfer")
+	post := &test.Post["Byzantium"][0]
+	post.Root[0] ^= 0xff
+	post.State[common.UnprefixedAddress(common.HexToAddress("0x2adc25665018aa1fe0e6bc666dac8fc2697ff9ba"))] = stAccount{Balance: post.State[common.UnprefixedAddress(common.HexToAddress("0x095e7baea6a6c7c4c2dfeb977efac326af552d87"))].Balance}
+
+	_, err := test.Run(StateSubtest{"Byzantium", 0}, vm.Config{})
+	if err == nil || !strings.Contains(err.Error(), "account 2adc25665018aa1fe0e6bc666dac8fc2697ff9ba balance: have 210000, want 100001") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// 没有预期到的交易错误同样是失败
+	test.Post["Byzantium"][1].ExpectException = ""
+	if _, err := test.Run(StateSubtest{"Byzantium", 1}, vm.Config{}); err == nil || !strings.Contains(err.Error(), "unexpected transaction error") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// loadStateTest 读取测试向量目录中给定文件里的一个测试
+func loadStateTest(t *testing.T, file, name string) *StateTest {
+	blob, err := ioutil.ReadFile(filepath.Join(stateTestDir, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests map[string]*StateTest
+	if err := json.Unmarshal(blob, &tests); err != nil {
+		t.Fatal(err)
+	}
+	test, ok := tests[name]
+	if !ok {
+		t.Fatalf("test %s not found in %s", name, file)
+	}
+	return test
+}
@@ -0,0 +1,357 @@
+// Package tests 实现了以太坊官方测试向量(GeneralStateTests 及同格式的 VMTests)的执行器，
+// 用于衡量 CuteEVM 与共识行为的差距
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"CuteEVM01"
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/common/hexutil"
+	"CuteEVM01/Out/common/math"
+	"CuteEVM01/Out/core"
+	"CuteEVM01/Out/core/rawdb"
+	"CuteEVM01/Out/core/state"
+	"CuteEVM01/Out/core/types"
+	"CuteEVM01/Out/crypto"
+	"CuteEVM01/Out/params"
+	"CuteEVM01/Out/rlp"
+	"CuteEVM01/runtime"
+)
+
+// forkAliases 将测试向量中使用的分叉名称映射到 runtime.Forks 中的名称
+var forkAliases = map[string]string{
+	"ConstantinopleFix": "Petersburg",
+	"Merge":             "London",
+	"Paris":             "London",
+}
+
+// postMerge 是合并之后的分叉，它们的 DIFFICULTY 返回区块环境中的 currentRandom
+var postMerge = map[string]bool{
+	"Merge":    true,
+	"Paris":    true,
+	"Shanghai": true,
+	"Cancun":   true,
+}
+
+// UnsupportedForkError 表示测试向量要求的分叉在 CuteEVM 中不存在
+type UnsupportedForkError struct {
+	Name string
+}
+
+func (e UnsupportedForkError) Error() string {
+	return fmt.Sprintf("unsupported fork %q", e.Name)
+}
+
+// forkConfig 返回测试向量中分叉名称对应的链配置
+func forkConfig(fork string) (*params.ChainConfig, error) {
+	name := fork
+	if alias, ok := forkAliases[fork]; ok {
+		name = alias
+	}
+	if _, ok := runtime.Forks[name]; !ok {
+		return nil, UnsupportedForkError{fork}
+	}
+	return runtime.ForkConfig(name)
+}
+
+// StateTest 是一个 GeneralStateTests 格式的测试: 预状态、区块环境、
+// 一个以数据/gas/金额下标展开的交易模板，以及每个分叉中每种组合的期望结果
+type StateTest struct {
+	Env         stEnv                    `json:"env"`
+	Pre         stAlloc                  `json:"pre"`
+	Transaction stTransaction            `json:"transaction"`
+	Post        map[string][]stPostState `json:"post"`
+}
+
+// StateSubtest 选择测试中的一个分叉和该分叉的一组期望结果
+type StateSubtest struct {
+	Fork  string
+	Index int
+}
+
+type stEnv struct {
+	Coinbase   common.Address        `json:"currentCoinbase"`
+	Difficulty *math.HexOrDecimal256 `json:"currentDifficulty"`
+	Random     *math.HexOrDecimal256 `json:"currentRandom"`
+	GasLimit   math.HexOrDecimal64   `json:"currentGasLimit"`
+	Number     math.HexOrDecimal64   `json:"currentNumber"`
+	Timestamp  math.HexOrDecimal64   `json:"currentTimestamp"`
+	BaseFee    *math.HexOrDecimal256 `json:"currentBaseFee"`
+}
+
+type stAccount struct {
+	Balance *math.HexOrDecimal256 `json:"balance"`
+	Nonce   math.HexOrDecimal64   `json:"nonce"`
+	Code    hexutil.Bytes         `json:"code"`
+	Storage map[stHash]stHash     `json:"storage"`
+}
+
+type stAlloc map[common.UnprefixedAddress]stAccount
+
+// stHash 是测试向量中的存储键和值，它们通常省略了前导的零
+type stHash common.Hash
+
+func (h *stHash) UnmarshalText(text []byte) error {
+	s := strings.TrimPrefix(strings.TrimPrefix(string(text), "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	b := common.FromHex(s)
+	if len(b) > common.HashLength || len(b) != len(s)/2 {
+		return fmt.Errorf("invalid storage hash %q", text)
+	}
+	*h = stHash(common.BytesToHash(b))
+	return nil
+}
+
+type stTransaction struct {
+	Data                 []string              `json:"data"`
+	GasLimit             []math.HexOrDecimal64 `json:"gasLimit"`
+	Value                []string              `json:"value"`
+	GasPrice             *math.HexOrDecimal256 `json:"gasPrice"`
+	MaxFeePerGas         *math.HexOrDecimal256 `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *math.HexOrDecimal256 `json:"maxPriorityFeePerGas"`
+	Nonce                math.HexOrDecimal64   `json:"nonce"`
+	To                   string                `json:"to"`
+	SecretKey            hexutil.Bytes         `json:"secretKey"`
+	Sender               *common.Address       `json:"sender"`
+}
+
+type stPostState struct {
+	Root            common.Hash `json:"hash"`
+	Logs            common.Hash `json:"logs"`
+	ExpectException string      `json:"expectException"`
+	State           stAlloc     `json:"state"` // 可选的后状态，只用于在状态根不一致时定位差异
+	Indexes         struct {
+		Data  int `json:"data"`
+		Gas   int `json:"gas"`
+		Value int `json:"value"`
+	} `json:"indexes"`
+}
+
+// Subtests 返回测试中所有的(分叉, 下标)组合，按分叉名称排序
+func (t *StateTest) Subtests() []StateSubtest {
+	var subtests []StateSubtest
+	for fork, posts := range t.Post {
+		for i := range posts {
+			subtests = append(subtests, StateSubtest{fork, i})
+		}
+	}
+	sortSubtests(subtests)
+	return subtests
+}
+
+// Run 执行一个子测试，并检查得到的状态根和日志哈希是否与期望一致
+func (t *StateTest) Run(subtest StateSubtest, vmconfig vm.Config) (*state.StateDB, error) {
+	statedb, root, err := t.RunNoVerify(subtest, vmconfig)
+	if err != nil {
+		return statedb, err
+	}
+	post := t.Post[subtest.Fork][subtest.Index]
+	if root != post.Root {
+		if err := diffPostState(statedb, post.State); err != nil {
+			return statedb, fmt.Errorf("post state root mismatch: have %x, want %x: %v", root, post.Root, err)
+		}
+		return statedb, fmt.Errorf("post state root mismatch: have %x, want %x", root, post.Root)
+	}
+	if logs := rlpHash(statedb.Logs()); logs != post.Logs {
+		return statedb, fmt.Errorf("post state logs hash mismatch: have %x, want %x", logs, post.Logs)
+	}
+	return statedb, nil
+}
+
+// RunNoVerify 执行一个子测试，返回执行后的状态及其状态根，但不检查期望的结果。
+// 交易无效时状态被回滚，只有在测试没有预期这个错误时才返回它
+func (t *StateTest) RunNoVerify(subtest StateSubtest, vmconfig vm.Config) (*state.StateDB, common.Hash, error) {
+	posts, ok := t.Post[subtest.Fork]
+	if !ok || subtest.Index >= len(posts) {
+		return nil, common.Hash{}, fmt.Errorf("no post state for %s/%d", subtest.Fork, subtest.Index)
+	}
+	config, err := forkConfig(subtest.Fork)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	post := posts[subtest.Index]
+
+	statedb, err := makePreState(t.Pre)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	number := new(big.Int).SetUint64(uint64(t.Env.Number))
+	baseFee := (*big.Int)(t.Env.BaseFee)
+	if config.IsLondon(number) && baseFee == nil {
+		// 没有给出base fee的伦敦测试使用默认值
+		baseFee = big.NewInt(0x0a)
+	}
+	msg, err := t.Transaction.toMessage(post, baseFee)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     vmTestBlockHash,
+		Origin:      msg.From(),
+		GasPrice:    msg.GasPrice(),
+		Coinbase:    t.Env.Coinbase,
+		GasLimit:    uint64(t.Env.GasLimit),
+		BlockNumber: number,
+		Time:        new(big.Int).SetUint64(uint64(t.Env.Timestamp)),
+		Difficulty:  new(big.Int),
+		BaseFee:     baseFee,
+	}
+	if t.Env.Difficulty != nil {
+		context.Difficulty = (*big.Int)(t.Env.Difficulty)
+	}
+	if postMerge[subtest.Fork] && t.Env.Random != nil {
+		context.Difficulty = (*big.Int)(t.Env.Random)
+	}
+	evm := vm.NewEVM(context, statedb, config, vmconfig)
+
+	snapshot := statedb.Snapshot()
+	gaspool := new(core.GasPool).AddGas(uint64(t.Env.GasLimit))
+	_, _, _, err = core.ApplyMessage(evm, msg, gaspool)
+	if err != nil {
+		statedb.RevertToSnapshot(snapshot)
+	}
+	// 和区块处理一样，coinbase总是被触碰，即使交易无效或没有支付手续费，
+	// 这决定了它在EIP-158之后是否作为空账户被删除
+	statedb.AddBalance(t.Env.Coinbase, new(big.Int))
+	root := statedb.IntermediateRoot(config.IsEIP158(number))
+
+	switch {
+	case err != nil && post.ExpectException == "":
+		return statedb, root, fmt.Errorf("unexpected transaction error: %v", err)
+	case err == nil && post.ExpectException != "":
+		return statedb, root, fmt.Errorf("expected transaction error %s", post.ExpectException)
+	}
+	return statedb, root, nil
+}
+
+// makePreState 在新的内存数据库中构造测试的预状态，并提交它，使存储的原始值与当前值一致
+func makePreState(alloc stAlloc) (*state.StateDB, error) {
+	db := state.NewDatabase(rawdb.NewMemoryDatabase())
+	statedb, _ := state.New(common.Hash{}, db)
+	for addr, account := range alloc {
+		address := common.Address(addr)
+		statedb.CreateAccount(address)
+		statedb.SetCode(address, account.Code)
+		statedb.SetNonce(address, uint64(account.Nonce))
+		if account.Balance != nil {
+			statedb.SetBalance(address, (*big.Int)(account.Balance))
+		}
+		for key, value := range account.Storage {
+			statedb.SetState(address, common.Hash(key), common.Hash(value))
+		}
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		return nil, err
+	}
+	return state.New(root, db)
+}
+
+// diffPostState 返回执行后的状态与期望的后状态中第一个不同的账户字段，
+// 只检查期望中列出的账户和存储槽，没有给出期望的后状态时返回nil
+func diffPostState(statedb *state.StateDB, expected stAlloc) error {
+	addrs := make([]common.Address, 0, len(expected))
+	for addr := range expected {
+		addrs = append(addrs, common.Address(addr))
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+
+	for _, addr := range addrs {
+		want := expected[common.UnprefixedAddress(addr)]
+		if !statedb.Exist(addr) {
+			return fmt.Errorf("account %x missing", addr)
+		}
+		if balance, wantBalance := statedb.GetBalance(addr), (*big.Int)(want.Balance); wantBalance != nil && balance.Cmp(wantBalance) != 0 {
+			return fmt.Errorf("account %x balance: have %v, want %v", addr, balance, wantBalance)
+		}
+		if nonce := statedb.GetNonce(addr); nonce != uint64(want.Nonce) {
+			return fmt.Errorf("account %x nonce: have %d, want %d", addr, nonce, want.Nonce)
+		}
+		if code := statedb.GetCode(addr); !bytes.Equal(code, want.Code) {
+			return fmt.Errorf("account %x code: have %x, want %x", addr, code, []byte(want.Code))
+		}
+		for key, value := range want.Storage {
+			if have := statedb.GetState(addr, common.Hash(key)); have != common.Hash(value) {
+				return fmt.Errorf("account %x storage %x: have %x, want %x", addr, key, have, value)
+			}
+		}
+	}
+	return nil
+}
+
+// toMessage 根据子测试的下标展开交易模板
+func (tx *stTransaction) toMessage(post stPostState, baseFee *big.Int) (types.Message, error) {
+	var from common.Address
+	switch {
+	case tx.Sender != nil:
+		from = *tx.Sender
+	case len(tx.SecretKey) > 0:
+		key, err := crypto.ToECDSA(tx.SecretKey)
+		if err != nil {
+			return types.Message{}, fmt.Errorf("invalid private key: %v", err)
+		}
+		from = crypto.PubkeyToAddress(key.PublicKey)
+	default:
+		return types.Message{}, fmt.Errorf("transaction has neither sender nor secretKey")
+	}
+	var to *common.Address
+	if tx.To != "" {
+		if !common.IsHexAddress(tx.To) {
+			return types.Message{}, fmt.Errorf("invalid to address %q", tx.To)
+		}
+		address := common.HexToAddress(tx.To)
+		to = &address
+	}
+
+	idx := post.Indexes
+	if idx.Data >= len(tx.Data) || idx.Gas >= len(tx.GasLimit) || idx.Value >= len(tx.Value) {
+		return types.Message{}, fmt.Errorf("tx index out of bounds: data %d, gas %d, value %d", idx.Data, idx.Gas, idx.Value)
+	}
+	data, err := hexutil.Decode(tx.Data[idx.Data])
+	if err != nil && tx.Data[idx.Data] != "" {
+		return types.Message{}, fmt.Errorf("invalid tx data %q", tx.Data[idx.Data])
+	}
+	value := new(big.Int)
+	if v := tx.Value[idx.Value]; v != "0x" && v != "" {
+		var ok bool
+		if value, ok = math.ParseBig256(v); !ok {
+			return types.Message{}, fmt.Errorf("invalid tx value %q", v)
+		}
+	}
+
+	// EIP-1559 交易按实际支付的价格执行: min(maxFeePerGas, baseFee + maxPriorityFeePerGas)
+	gasPrice := (*big.Int)(tx.GasPrice)
+	if tx.MaxFeePerGas != nil {
+		gasPrice = (*big.Int)(tx.MaxFeePerGas)
+		if baseFee != nil && tx.MaxPriorityFeePerGas != nil {
+			tip := new(big.Int).Add(baseFee, (*big.Int)(tx.MaxPriorityFeePerGas))
+			if tip.Cmp(gasPrice) < 0 {
+				gasPrice = tip
+			}
+		}
+	}
+	if gasPrice == nil {
+		return types.Message{}, fmt.Errorf("no gas price provided")
+	}
+	return types.NewMessage(from, to, uint64(tx.Nonce), value, uint64(tx.GasLimit[idx.Gas]), gasPrice, data, true), nil
+}
+
+// vmTestBlockHash 是测试向量约定的区块哈希: 区块号十进制字符串的Keccak256
+func vmTestBlockHash(n uint64) common.Hash {
+	return common.BytesToHash(crypto.Keccak256([]byte(new(big.Int).SetUint64(n).String())))
+}
+
+// rlpHash 返回x的RLP编码的Keccak256
+func rlpHash(x interface{}) common.Hash {
+	blob, _ := rlp.EncodeToBytes(x)
+	return crypto.Keccak256Hash(blob)
+}
@@ -0,0 +1,492 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+
+	"CuteEVM01/Out/common"
+	"CuteEVM01/Out/params"
+	"CuteEVM01/Out/rlp"
+)
+
+// executionTraceVersion 是二进制执行轨迹格式的版本
+const executionTraceVersion = 1
+
+// ExecutionTrace 是一次顶层执行的完整记录: 每一步的执行位置，以及执行中读取的全部外部输入。
+//
+// 外部输入包括每个被访问的账户和存储槽在第一次访问时的值、访问列表中初始就是热访问的条目、
+// BLOCKHASH 读取的区块哈希以及区块和交易环境，足以在空状态上离线重放这次执行
+type ExecutionTrace struct {
+	Version     uint
+	ChainConfig []byte // JSON编码的链配置
+	Context     TraceContext
+	Call        TraceCall
+	Accounts    []TraceAccount
+	AccessList  []TraceAccessEntry
+	Refund      uint64
+	Steps       []TraceStep
+	Output      []byte
+	GasUsed     uint64
+	Error       string
+}
+
+// TraceContext 是执行时的区块和交易环境
+type TraceContext struct {
+	Origin      common.Address
+	GasPrice    *big.Int
+	Coinbase    common.Address
+	GasLimit    uint64
+	BlockNumber *big.Int
+	Time        *big.Int
+	BaseFee     *big.Int
+	Difficulty  *big.Int
+	Hashes      []TraceBlockHash
+}
+
+// TraceBlockHash 是一次 GetHash 调用的结果
+type TraceBlockHash struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// TraceCall 是顶层调用的参数，Create 为true时 To 是新合约的地址，Input 是初始化代码
+type TraceCall struct {
+	Create bool
+	From   common.Address
+	To     common.Address
+	Input  []byte
+	Gas    uint64
+	Value  *big.Int
+}
+
+// TraceAccount 是账户在第一次被访问时的状态
+type TraceAccount struct {
+	Address common.Address
+	Exists  bool
+	Balance *big.Int
+	Nonce   uint64
+	Code    []byte
+	Storage []TraceSlot
+}
+
+// TraceSlot 是存储槽在第一次被访问时的当前值与交易开始时的原始值
+type TraceSlot struct {
+	Key      common.Hash
+	Original common.Hash
+	Value    common.Hash
+}
+
+// TraceAccessEntry 是执行开始时就在访问列表中的地址，以及它的存储槽
+type TraceAccessEntry struct {
+	Address common.Address
+	Warm    bool // 地址本身是否在访问列表中
+	Slots   []common.Hash
+}
+
+// TraceStep 是执行的一步
+type TraceStep struct {
+	Pc    uint64
+	Op    OpCode
+	Gas   uint64
+	Cost  uint64
+	Depth uint64
+}
+
+// Encode 将执行轨迹以RLP编码写入w
+func (t *ExecutionTrace) Encode(w io.Writer) error {
+	return rlp.Encode(w, t)
+}
+
+// DecodeExecutionTrace 从r中读取由 Encode 写入的执行轨迹
+func DecodeExecutionTrace(r io.Reader) (*ExecutionTrace, error) {
+	t := new(ExecutionTrace)
+	if err := rlp.Decode(r, t); err != nil {
+		return nil, err
+	}
+	if t.Version != executionTraceVersion {
+		return nil, fmt.Errorf("unsupported trace version %d", t.Version)
+	}
+	return t, nil
+}
+
+// Config 解码执行轨迹中的链配置
+func (t *ExecutionTrace) Config() (*params.ChainConfig, error) {
+	config := new(params.ChainConfig)
+	if err := json.Unmarshal(t.ChainConfig, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// TraceDivergence 描述两条执行轨迹的第一处不同，Step 为-1时不同出现在执行结果中
+type TraceDivergence struct {
+	Step  int
+	Field string
+	Have  string
+	Want  string
+}
+
+func (d *TraceDivergence) Error() string {
+	if d.Step < 0 {
+		return fmt.Sprintf("trace diverged in %s: have %s, want %s", d.Field, d.Have, d.Want)
+	}
+	return fmt.Sprintf("trace diverged at step %d in %s: have %s, want %s", d.Step, d.Field, d.Have, d.Want)
+}
+
+// Compare 逐步比较重放得到的执行轨迹 replay 与 t，返回第一处不同，完全一致时返回nil
+func (t *ExecutionTrace) Compare(replay *ExecutionTrace) error {
+	for i := 0; i < len(t.Steps) && i < len(replay.Steps); i++ {
+		want, have := t.Steps[i], replay.Steps[i]
+		switch {
+		case have.Depth != want.Depth:
+			return &TraceDivergence{i, "depth", fmt.Sprint(have.Depth), fmt.Sprint(want.Depth)}
+		case have.Pc != want.Pc:
+			return &TraceDivergence{i, "pc", fmt.Sprint(have.Pc), fmt.Sprint(want.Pc)}
+		case have.Op != want.Op:
+			return &TraceDivergence{i, "op", have.Op.String(), want.Op.String()}
+		case have.Gas != want.Gas:
+			return &TraceDivergence{i, "gas", fmt.Sprint(have.Gas), fmt.Sprint(want.Gas)}
+		case have.Cost != want.Cost:
+			return &TraceDivergence{i, "cost", fmt.Sprint(have.Cost), fmt.Sprint(want.Cost)}
+		}
+	}
+	switch {
+	case len(replay.Steps) != len(t.Steps):
+		return &TraceDivergence{-1, "step count", fmt.Sprint(len(replay.Steps)), fmt.Sprint(len(t.Steps))}
+	case !bytes.Equal(replay.Output, t.Output):
+		return &TraceDivergence{-1, "output", fmt.Sprintf("%x", replay.Output), fmt.Sprintf("%x", t.Output)}
+	case replay.GasUsed != t.GasUsed:
+		return &TraceDivergence{-1, "gas used", fmt.Sprint(replay.GasUsed), fmt.Sprint(t.GasUsed)}
+	case replay.Error != t.Error:
+		return &TraceDivergence{-1, "error", fmt.Sprintf("%q", replay.Error), fmt.Sprintf("%q", t.Error)}
+	}
+	return nil
+}
+
+// TraceRecorder 记录一次执行的 ExecutionTrace。
+//
+// 它既是 Tracer，也包装了执行使用的 StateDB 和 Context 以记录外部输入，三者需要同时使用:
+//
+//	rec := vm.NewTraceRecorder(chainConfig)
+//	evm := vm.NewEVM(rec.WrapContext(ctx), rec.WrapStateDB(statedb), chainConfig, vm.Config{Debug: true, Tracer: rec})
+type TraceRecorder struct {
+	trace   ExecutionTrace
+	statedb StateDB
+
+	accounts  map[common.Address]*TraceAccount
+	slots     map[common.Address]map[common.Hash]TraceSlot
+	warmAddrs map[common.Address]bool
+	warmSlots map[common.Address]map[common.Hash]bool
+	hashes    map[uint64]common.Hash
+}
+
+// NewTraceRecorder 返回一个新的执行轨迹记录器
+func NewTraceRecorder(chainConfig *params.ChainConfig) *TraceRecorder {
+	config, _ := json.Marshal(chainConfig)
+	return &TraceRecorder{
+		trace:     ExecutionTrace{Version: executionTraceVersion, ChainConfig: config},
+		accounts:  make(map[common.Address]*TraceAccount),
+		slots:     make(map[common.Address]map[common.Hash]TraceSlot),
+		warmAddrs: make(map[common.Address]bool),
+		warmSlots: make(map[common.Address]map[common.Hash]bool),
+		hashes:    make(map[uint64]common.Hash),
+	}
+}
+
+// WrapContext 记录给定的执行环境，并返回一个会记录 GetHash 结果的副本
+func (r *TraceRecorder) WrapContext(ctx Context) Context {
+	r.trace.Context = TraceContext{
+		Origin:      ctx.Origin,
+		GasPrice:    ctx.GasPrice,
+		Coinbase:    ctx.Coinbase,
+		GasLimit:    ctx.GasLimit,
+		BlockNumber: ctx.BlockNumber,
+		Time:        ctx.Time,
+		BaseFee:     ctx.BaseFee,
+		Difficulty:  ctx.Difficulty,
+	}
+	getHash := ctx.GetHash
+	ctx.GetHash = func(n uint64) common.Hash {
+		hash := getHash(n)
+		r.hashes[n] = hash
+		return hash
+	}
+	return ctx
+}
+
+// WrapStateDB 返回一个会记录所有被访问状态的 StateDB
+func (r *TraceRecorder) WrapStateDB(statedb StateDB) StateDB {
+	r.statedb = statedb
+	return &recordingStateDB{StateDB: statedb, rec: r}
+}
+
+// Trace 返回记录的执行轨迹，必须在执行结束之后调用
+func (r *TraceRecorder) Trace() *ExecutionTrace {
+	trace := r.trace
+	trace.Accounts = make([]TraceAccount, 0, len(r.accounts))
+	for addr, account := range r.accounts {
+		acc := *account
+		for _, slot := range r.slots[addr] {
+			acc.Storage = append(acc.Storage, slot)
+		}
+		sort.Slice(acc.Storage, func(i, j int) bool {
+			return bytes.Compare(acc.Storage[i].Key[:], acc.Storage[j].Key[:]) < 0
+		})
+		trace.Accounts = append(trace.Accounts, acc)
+	}
+	sort.Slice(trace.Accounts, func(i, j int) bool {
+		return bytes.Compare(trace.Accounts[i].Address[:], trace.Accounts[j].Address[:]) < 0
+	})
+
+	entries := make(map[common.Address]*TraceAccessEntry)
+	for addr, warm := range r.warmAddrs {
+		if warm {
+			entries[addr] = &TraceAccessEntry{Address: addr, Warm: true}
+		}
+	}
+	for addr, slots := range r.warmSlots {
+		for slot, warm := range slots {
+			if !warm {
+				continue
+			}
+			if entries[addr] == nil {
+				entries[addr] = &TraceAccessEntry{Address: addr}
+			}
+			entries[addr].Slots = append(entries[addr].Slots, slot)
+		}
+	}
+	trace.AccessList = nil
+	for _, entry := range entries {
+		sort.Slice(entry.Slots, func(i, j int) bool {
+			return bytes.Compare(entry.Slots[i][:], entry.Slots[j][:]) < 0
+		})
+		trace.AccessList = append(trace.AccessList, *entry)
+	}
+	sort.Slice(trace.AccessList, func(i, j int) bool {
+		return bytes.Compare(trace.AccessList[i].Address[:], trace.AccessList[j].Address[:]) < 0
+	})
+
+	trace.Context.Hashes = nil
+	for n, hash := range r.hashes {
+		trace.Context.Hashes = append(trace.Context.Hashes, TraceBlockHash{n, hash})
+	}
+	sort.Slice(trace.Context.Hashes, func(i, j int) bool {
+		return trace.Context.Hashes[i].Number < trace.Context.Hashes[j].Number
+	})
+	return &trace
+}
+
+// touchAccount 在账户第一次被访问时记录它的状态
+func (r *TraceRecorder) touchAccount(addr common.Address) {
+	if _, ok := r.accounts[addr]; ok {
+		return
+	}
+	account := &TraceAccount{Address: addr, Balance: new(big.Int)}
+	if r.statedb.Exist(addr) {
+		account.Exists = true
+		account.Balance = new(big.Int).Set(r.statedb.GetBalance(addr))
+		account.Nonce = r.statedb.GetNonce(addr)
+		account.Code = common.CopyBytes(r.statedb.GetCode(addr))
+	}
+	r.accounts[addr] = account
+}
+
+// touchSlot 在存储槽第一次被访问时记录它的值
+func (r *TraceRecorder) touchSlot(addr common.Address, key common.Hash) {
+	r.touchAccount(addr)
+	if _, ok := r.slots[addr][key]; ok {
+		return
+	}
+	if r.slots[addr] == nil {
+		r.slots[addr] = make(map[common.Hash]TraceSlot)
+	}
+	r.slots[addr][key] = TraceSlot{
+		Key:      key,
+		Original: r.statedb.GetCommittedState(addr, key),
+		Value:    r.statedb.GetState(addr, key),
+	}
+}
+
+// touchAccessAddress 在地址第一次出现在访问列表操作中时，记录它是否已经在访问列表中
+func (r *TraceRecorder) touchAccessAddress(addr common.Address) {
+	if _, ok := r.warmAddrs[addr]; !ok {
+		r.warmAddrs[addr] = r.statedb.AddressInAccessList(addr)
+	}
+}
+
+// touchAccessSlot 在存储槽第一次出现在访问列表操作中时，记录它是否已经在访问列表中
+func (r *TraceRecorder) touchAccessSlot(addr common.Address, slot common.Hash) {
+	r.touchAccessAddress(addr)
+	if _, ok := r.warmSlots[addr][slot]; ok {
+		return
+	}
+	if r.warmSlots[addr] == nil {
+		r.warmSlots[addr] = make(map[common.Hash]bool)
+	}
+	_, r.warmSlots[addr][slot] = r.statedb.SlotInAccessList(addr, slot)
+}
+
+// CaptureStart 记录顶层调用的参数和初始的退款计数
+func (r *TraceRecorder) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	r.trace.Call = TraceCall{
+		Create: create,
+		From:   from,
+		To:     to,
+		Input:  common.CopyBytes(input),
+		Gas:    gas,
+		Value:  new(big.Int),
+	}
+	if value != nil {
+		r.trace.Call.Value.Set(value)
+	}
+	r.trace.Refund = r.statedb.GetRefund()
+	return nil
+}
+
+// CaptureState 记录执行的一步
+func (r *TraceRecorder) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	r.trace.Steps = append(r.trace.Steps, TraceStep{Pc: pc, Op: op, Gas: gas, Cost: cost, Depth: uint64(depth)})
+	return nil
+}
+
+// CaptureFault 实现 Tracer 接口
+func (r *TraceRecorder) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd 记录执行结果
+func (r *TraceRecorder) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	r.trace.Output = common.CopyBytes(output)
+	r.trace.GasUsed = gasUsed
+	r.trace.Error = ""
+	if err != nil {
+		r.trace.Error = err.Error()
+	}
+	return nil
+}
+
+// CaptureEnter 实现 Tracer 接口
+func (r *TraceRecorder) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit 实现 Tracer 接口
+func (r *TraceRecorder) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// recordingStateDB 在转发每个操作之前记录被访问的账户、存储槽和访问列表条目的初始状态
+type recordingStateDB struct {
+	StateDB
+	rec *TraceRecorder
+}
+
+func (s *recordingStateDB) CreateAccount(addr common.Address) {
+	s.rec.touchAccount(addr)
+	s.StateDB.CreateAccount(addr)
+}
+
+func (s *recordingStateDB) SubBalance(addr common.Address, amount *big.Int) {
+	s.rec.touchAccount(addr)
+	s.StateDB.SubBalance(addr, amount)
+}
+
+func (s *recordingStateDB) AddBalance(addr common.Address, amount *big.Int) {
+	s.rec.touchAccount(addr)
+	s.StateDB.AddBalance(addr, amount)
+}
+
+func (s *recordingStateDB) GetBalance(addr common.Address) *big.Int {
+	s.rec.touchAccount(addr)
+	return s.StateDB.GetBalance(addr)
+}
+
+func (s *recordingStateDB) GetNonce(addr common.Address) uint64 {
+	s.rec.touchAccount(addr)
+	return s.StateDB.GetNonce(addr)
+}
+
+func (s *recordingStateDB) SetNonce(addr common.Address, nonce uint64) {
+	s.rec.touchAccount(addr)
+	s.StateDB.SetNonce(addr, nonce)
+}
+
+func (s *recordingStateDB) GetCodeHash(addr common.Address) common.Hash {
+	s.rec.touchAccount(addr)
+	return s.StateDB.GetCodeHash(addr)
+}
+
+func (s *recordingStateDB) GetCode(addr common.Address) []byte {
+	s.rec.touchAccount(addr)
+	return s.StateDB.GetCode(addr)
+}
+
+func (s *recordingStateDB) SetCode(addr common.Address, code []byte) {
+	s.rec.touchAccount(addr)
+	s.StateDB.SetCode(addr, code)
+}
+
+func (s *recordingStateDB) GetCodeSize(addr common.Address) int {
+	s.rec.touchAccount(addr)
+	return s.StateDB.GetCodeSize(addr)
+}
+
+func (s *recordingStateDB) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
+	s.rec.touchSlot(addr, key)
+	return s.StateDB.GetCommittedState(addr, key)
+}
+
+func (s *recordingStateDB) GetState(addr common.Address, key common.Hash) common.Hash {
+	s.rec.touchSlot(addr, key)
+	return s.StateDB.GetState(addr, key)
+}
+
+func (s *recordingStateDB) SetState(addr common.Address, key, value common.Hash) {
+	s.rec.touchSlot(addr, key)
+	s.StateDB.SetState(addr, key, value)
+}
+
+func (s *recordingStateDB) Suicide(addr common.Address) bool {
+	s.rec.touchAccount(addr)
+	return s.StateDB.Suicide(addr)
+}
+
+func (s *recordingStateDB) HasSuicided(addr common.Address) bool {
+	s.rec.touchAccount(addr)
+	return s.StateDB.HasSuicided(addr)
+}
+
+func (s *recordingStateDB) Exist(addr common.Address) bool {
+	s.rec.touchAccount(addr)
+	return s.StateDB.Exist(addr)
+}
+
+func (s *recordingStateDB) Empty(addr common.Address) bool {
+	s.rec.touchAccount(addr)
+	return s.StateDB.Empty(addr)
+}
+
+func (s *recordingStateDB) AddressInAccessList(addr common.Address) bool {
+	s.rec.touchAccessAddress(addr)
+	return s.StateDB.AddressInAccessList(addr)
+}
+
+func (s *recordingStateDB) SlotInAccessList(addr common.Address, slot common.Hash) (bool, bool) {
+	s.rec.touchAccessSlot(addr, slot)
+	return s.StateDB.SlotInAccessList(addr, slot)
+}
+
+func (s *recordingStateDB) AddAddressToAccessList(addr common.Address) {
+	s.rec.touchAccessAddress(addr)
+	s.StateDB.AddAddressToAccessList(addr)
+}
+
+func (s *recordingStateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	s.rec.touchAccessSlot(addr, slot)
+	s.StateDB.AddSlotToAccessList(addr, slot)
+}
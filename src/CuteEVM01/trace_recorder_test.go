@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"CuteEVM01/Out/params"
+)
+
+func TestExecutionTraceCompare(t *testing.T) {
+	rec := NewTraceRecorder(params.AllEthashProtocolChanges)
+	rec.CaptureState(nil, 0, PUSH1, 100, 3, nil, nil, nil, 1, nil)
+	rec.CaptureState(nil, 2, STOP, 97, 0, nil, nil, nil, 1, nil)
+	rec.CaptureEnd([]byte{1}, 3, 0, nil)
+	trace := rec.Trace()
+
+	var buf bytes.Buffer
+	if err := trace.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeExecutionTrace(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to decode trace: %v", err)
+	}
+	if err := trace.Compare(decoded); err != nil {
+		t.Errorf("decoded trace differs: %v", err)
+	}
+	if config, err := decoded.Config(); err != nil || !config.IsBerlin(new(big.Int)) {
+		t.Errorf("chain config mismatch: %v", err)
+	}
+
+	tests := []struct {
+		mutate func(*ExecutionTrace)
+		want   string
+	}{
+		{func(t *ExecutionTrace) { t.Steps[1].Gas = 96 }, "trace diverged at step 1 in gas: have 96, want 97"},
+		{func(t *ExecutionTrace) { t.Steps[0].Op = PUSH2 }, "trace diverged at step 0 in op: have PUSH2, want PUSH1"},
+		{func(t *ExecutionTrace) { t.Steps = t.Steps[:1] }, "trace diverged in step count: have 1, want 2"},
+		{func(t *ExecutionTrace) { t.Output = nil }, "trace diverged in output: have , want 01"},
+		{func(t *ExecutionTrace) { t.Error = "boom" }, `trace diverged in error: have "boom", want ""`},
+	}
+	for i, tt := range tests {
+		replay, _ := DecodeExecutionTrace(bytes.NewReader(buf.Bytes()))
+		tt.mutate(replay)
+		if err := trace.Compare(replay); err == nil || err.Error() != tt.want {
+			t.Errorf("test %d: have %v, want %q", i, err, tt.want)
+		}
+	}
+}